@@ -0,0 +1,34 @@
+package main
+
+import (
+	"autoui-platform/backend/internal/agent"
+	"autoui-platform/backend/internal/config"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	cfg := config.LoadRunnerConfig()
+	if cfg.RegistrationToken == "" {
+		log.Fatal("AGENT_REGISTRATION_TOKEN is required")
+	}
+	if cfg.Capacity <= 0 {
+		log.Fatal("AGENT_CAPACITY must be at least 1")
+	}
+
+	// Stop leasing on the first signal and let running executions finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Agent %s starting, server %s", cfg.Name, cfg.ServerURL)
+
+	runner := agent.NewRunner(cfg)
+	if err := runner.Run(ctx); err != nil {
+		log.Fatal("Agent stopped:", err)
+	}
+
+	log.Println("Agent stopped")
+}
@@ -5,13 +5,17 @@ import (
 	"autoui-platform/backend/internal/api/routes"
 	"autoui-platform/backend/internal/services"
 	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/recorder"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/auth"
+	"context"
 	"log"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,10 +36,23 @@ func main() {
 	}
 
 	// Initialize test executor
-	executor.InitExecutor(cfg.Chrome.MaxInstances)
+	executor.InitExecutor(
+		cfg.Chrome.MaxInstances,
+		time.Duration(cfg.Executor.LeaseTimeoutSeconds)*time.Second,
+		cfg.Executor.RequeueStale,
+	)
+
+	// Score test cases for flakiness as their executions finish
+	services.InitFlakiness(cfg.Flakiness.Threshold, cfg.Flakiness.Window, cfg.Flakiness.MinRuns)
+
+	// Reap abandoned recording sessions
+	recorder.Manager.StartReaper(
+		time.Duration(cfg.Recording.IdleTimeoutMinutes)*time.Minute,
+		time.Duration(cfg.Recording.MaxLifetimeMinutes)*time.Minute,
+	)
 
 	// Initialize scheduler service
-	if err := services.InitScheduler(); err != nil {
+	if err := services.InitScheduler(time.Duration(cfg.Scheduler.CatchUpWindowMinutes) * time.Minute); err != nil {
 		log.Fatal("Failed to initialize scheduler:", err)
 	}
 
@@ -45,28 +62,43 @@ func main() {
 	// Initialize router
 	router := routes.SetupRoutes(cfg)
 
-	// Setup graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
+		Handler: router,
+	}
 
+	// Start server
 	go func() {
-		<-c
-		log.Println("Shutting down server...")
-		
-		// Stop scheduler
-		if services.GlobalScheduler != nil {
-			services.GlobalScheduler.Stop()
+		log.Printf("Server starting on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
 		}
-		
-		log.Println("Server shutdown complete")
-		os.Exit(0)
 	}()
 
-	// Start server
-	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Server starting on %s", addr)
-	
-	if err := router.Run(addr); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Wait for a shutdown signal
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	log.Println("Shutting down server...")
+
+	// Stop scheduling new runs
+	if services.GlobalScheduler != nil {
+		services.GlobalScheduler.Stop()
+	}
+
+	// Let running executions finish. The API keeps serving meanwhile, so
+	// agents can report results and new executions are queued for the next start.
+	executor.GlobalExecutor.Shutdown(time.Duration(cfg.Server.ShutdownGraceSeconds) * time.Second)
+
+	if closed := recorder.Manager.CloseAll(); closed > 0 {
+		log.Printf("Closed %d recording sessions", closed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
 	}
-}
\ No newline at end of file
+
+	log.Println("Server shutdown complete")
+}
@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthorized is returned when the server no longer accepts the agent
+// token, the agent has to register again.
+var ErrUnauthorized = errors.New("agent token rejected by server")
+
+// ServerError is an error the server reported for a request it received.
+type ServerError struct {
+	Code    int
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.Code, e.Message)
+}
+
+// Client calls the agent API of a server.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	mutex      sync.RWMutex
+	token      string
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// apiResponse is the envelope every server response is wrapped in.
+type apiResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Register registers the agent with the registration token and keeps the
+// issued agent token for further requests.
+func (c *Client) Register(registrationToken string, req RegisterRequest) (*RegisterResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.url("/agent/register"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var resp RegisterResponse
+	if err := c.send(httpReq, registrationToken, &resp); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.token = resp.Token
+	c.mutex.Unlock()
+	return &resp, nil
+}
+
+func (c *Client) Heartbeat(running []uint) (*HeartbeatResponse, error) {
+	var resp HeartbeatResponse
+	if err := c.postJSON("/agent/heartbeat", HeartbeatRequest{Running: running}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Lease(slots int) (*LeaseResponse, error) {
+	var resp LeaseResponse
+	if err := c.postJSON("/agent/lease", LeaseRequest{Slots: slots}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) SendLogs(executionID uint, req LogsRequest) error {
+	return c.postJSON(fmt.Sprintf("/agent/executions/%d/logs", executionID), req, nil)
+}
+
+func (c *Client) SendResult(executionID uint, req ResultRequest) error {
+	return c.postJSON(fmt.Sprintf("/agent/executions/%d/result", executionID), req, nil)
+}
+
+// UploadArtifact uploads a file produced by an execution, such as a
+// screenshot, and returns the name the server stored it under.
+func (c *Client) UploadArtifact(executionID uint, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url(fmt.Sprintf("/agent/executions/%d/artifacts", executionID)), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var resp ArtifactResponse
+	if err := c.do(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.FileName, nil
+}
+
+// DownloadFile saves a file attached to a test case to path.
+func (c *Client) DownloadFile(fileID uint, path string) error {
+	req, err := http.NewRequest(http.MethodGet, c.url(fmt.Sprintf("/agent/files/%d", fileID)), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.currentToken())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	// Errors come back as a JSON envelope, files as attachments
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return c.decode(resp, nil)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
+
+func (c *Client) url(path string) string {
+	return c.baseURL + path
+}
+
+func (c *Client) postJSON(path string, payload interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url(path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, result)
+}
+
+func (c *Client) currentToken() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.token
+}
+
+func (c *Client) do(req *http.Request, result interface{}) error {
+	return c.send(req, c.currentToken(), result)
+}
+
+func (c *Client) send(req *http.Request, token string, result interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return c.decode(resp, result)
+}
+
+// decode unwraps the response envelope into result. The server reports most
+// errors with status 200 and the error code in the envelope.
+func (c *Client) decode(resp *http.Response, result interface{}) error {
+	var envelope apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return ErrUnauthorized
+		}
+		return fmt.Errorf("unexpected response from server (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || envelope.Code == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if envelope.Code != http.StatusOK {
+		return &ServerError{Code: envelope.Code, Message: envelope.Message}
+	}
+
+	if result != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, result)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package agent runs queued executions on a separate machine. An agent
+// registers with the server, leases executions over the agent API, runs them
+// with the executor package and reports logs, screenshots and results back.
+package agent
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"fmt"
+)
+
+// Requests and responses of the agent API, shared by the server handlers and
+// the agent.
+
+type RegisterRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Hostname  string   `json:"hostname"`
+	Version   string   `json:"version"`
+	Capacity  int      `json:"capacity" binding:"required,min=1"`
+	DeviceIDs []uint   `json:"device_ids"`
+	Browsers  []string `json:"browsers"`
+}
+
+type RegisterResponse struct {
+	AgentID             uint   `json:"agent_id"`
+	Token               string `json:"token"` // authenticates every further request
+	LeaseTimeoutSeconds int    `json:"lease_timeout_seconds"`
+}
+
+type HeartbeatRequest struct {
+	Running []uint `json:"running"` // executions the agent is running
+}
+
+type HeartbeatResponse struct {
+	Cancelled []uint `json:"cancelled"` // executions the agent must stop, they were cancelled or taken over
+}
+
+type LeaseRequest struct {
+	Slots int `json:"slots" binding:"required,min=1"`
+}
+
+type LeaseResponse struct {
+	Executions []models.TestExecution `json:"executions"` // loaded with test case, environment, device and files
+}
+
+type LogsRequest struct {
+	Logs []executor.ExecutionLog `json:"logs"`
+}
+
+type ResultRequest struct {
+	Success      bool                      `json:"success"`
+	Cancelled    bool                      `json:"cancelled"`
+	ErrorMessage string                    `json:"error_message"`
+	Logs         []executor.ExecutionLog   `json:"logs"`
+	Screenshots  []string                  `json:"screenshots"` // file names the uploaded screenshots were stored under
+	Metrics      *models.PerformanceMetric `json:"metrics"`
+}
+
+type ArtifactResponse struct {
+	FileName string `json:"file_name"` // name the file was stored under
+}
+
+// ArtifactName is the name an artifact of an execution is stored under, so
+// that agents can't overwrite the files of other executions.
+func ArtifactName(executionID uint, fileName string) string {
+	return fmt.Sprintf("%d_%s", executionID, fileName)
+}
+
+// LeaseOwner is the lease owner of executions run by the named agent.
+func LeaseOwner(name string) string {
+	return "agent:" + name
+}
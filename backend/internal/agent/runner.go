@@ -0,0 +1,368 @@
+package agent
+
+import (
+	"autoui-platform/backend/internal/config"
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/chrome"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Version is reported to the server when registering.
+const Version = "1.0.0"
+
+// The agent asks for work this often while it has free capacity, and sends
+// buffered log entries of running executions this often.
+const (
+	pollInterval     = 3 * time.Second
+	logFlushInterval = 2 * time.Second
+)
+
+// Runner leases executions from the server and runs up to Capacity of them
+// at the same time.
+type Runner struct {
+	cfg    *config.RunnerConfig
+	client *Client
+
+	mutex        sync.Mutex
+	leaseTimeout time.Duration
+	running      map[uint]context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func NewRunner(cfg *config.RunnerConfig) *Runner {
+	return &Runner{
+		cfg:     cfg,
+		client:  NewClient(cfg.ServerURL),
+		running: make(map[uint]context.CancelFunc),
+	}
+}
+
+// Run registers with the server and runs leased executions until ctx is
+// done. Executions already running are then finished before it returns.
+func (r *Runner) Run(ctx context.Context) error {
+	if chrome.GetChromePath() == "" {
+		return fmt.Errorf("chrome browser not found, install Google Chrome or Chromium")
+	}
+	if err := r.register(ctx); err != nil {
+		return err
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	go r.heartbeat(heartbeatCtx)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.leaseAndRun()
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Waiting for %d running executions to finish", r.runningCount())
+			r.wg.Wait()
+			stopHeartbeat()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// register registers with the server, retrying until it succeeds or ctx is
+// done.
+func (r *Runner) register(ctx context.Context) error {
+	req := RegisterRequest{
+		Name:      r.cfg.Name,
+		Version:   Version,
+		Capacity:  r.cfg.Capacity,
+		DeviceIDs: parseDeviceIDs(r.cfg.DeviceIDs),
+		Browsers:  []string{filepath.Base(chrome.GetChromePath())},
+	}
+	req.Hostname, _ = os.Hostname()
+
+	for {
+		resp, err := r.client.Register(r.cfg.RegistrationToken, req)
+		if err == nil {
+			r.mutex.Lock()
+			r.leaseTimeout = time.Duration(resp.LeaseTimeoutSeconds) * time.Second
+			r.mutex.Unlock()
+			log.Printf("Registered as agent %d (%s) with capacity %d", resp.AgentID, r.cfg.Name, r.cfg.Capacity)
+			return nil
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("registration rejected, check AGENT_REGISTRATION_TOKEN: %w", err)
+		}
+
+		log.Printf("Failed to register with %s, retrying: %v", r.cfg.ServerURL, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (r *Runner) leaseAndRun() {
+	free := r.cfg.Capacity - r.runningCount()
+	if free <= 0 {
+		return
+	}
+
+	resp, err := r.client.Lease(free)
+	if err != nil {
+		r.handleError("lease executions", err)
+		return
+	}
+
+	for _, execution := range resp.Executions {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.mutex.Lock()
+		r.running[execution.ID] = cancel
+		r.mutex.Unlock()
+
+		r.wg.Add(1)
+		go func(execution models.TestExecution) {
+			defer r.wg.Done()
+			defer r.finish(execution.ID)
+			r.execute(ctx, execution)
+		}(execution)
+	}
+}
+
+// heartbeat keeps the leases of running executions alive and stops the ones
+// the server no longer wants run.
+func (r *Runner) heartbeat(ctx context.Context) {
+	interval := r.getLeaseTimeout() / 3
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mutex.Lock()
+		running := make([]uint, 0, len(r.running))
+		for executionID := range r.running {
+			running = append(running, executionID)
+		}
+		r.mutex.Unlock()
+
+		resp, err := r.client.Heartbeat(running)
+		if err != nil {
+			r.handleError("send heartbeat", err)
+			continue
+		}
+
+		for _, executionID := range resp.Cancelled {
+			r.mutex.Lock()
+			cancel, ok := r.running[executionID]
+			r.mutex.Unlock()
+			if ok {
+				log.Printf("Stopping execution %d, it was cancelled on the server", executionID)
+				cancel()
+			}
+		}
+	}
+}
+
+// execute runs a leased execution and reports its logs, screenshots and
+// result back to the server.
+func (r *Runner) execute(ctx context.Context, execution models.TestExecution) {
+	log.Printf("Running execution %d of test case %d", execution.ID, execution.TestCaseID)
+
+	workDir, err := os.MkdirTemp("", fmt.Sprintf("autoui-execution-%d-", execution.ID))
+	if err != nil {
+		r.report(execution.ID, ResultRequest{ErrorMessage: fmt.Sprintf("Failed to create work directory: %v", err)})
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	// Files for upload steps are fetched from the server
+	testCase := execution.TestCase
+	for i := range testCase.Files {
+		file := &testCase.Files[i]
+		file.FilePath = filepath.Join(workDir, fmt.Sprintf("%d_%s", file.ID, filepath.Base(file.FileName)))
+		if err := r.client.DownloadFile(file.ID, file.FilePath); err != nil {
+			r.report(execution.ID, ResultRequest{ErrorMessage: fmt.Sprintf("Failed to download file %s: %v", file.FileName, err)})
+			return
+		}
+	}
+
+	logs := newLogStreamer(r.client, execution.ID)
+	go logs.run(ctx)
+
+	result := executor.RunTestCase(ctx, &testCase, executor.RunOptions{
+		IsVisual: execution.IsVisual && !r.cfg.Headless,
+		OnLog:    logs.add,
+	})
+	logs.stop()
+
+	if ctx.Err() != nil {
+		result.Success = false
+		result.Cancelled = true
+		result.ErrorMessage = "Execution cancelled"
+	}
+
+	// Screenshots are written to ./screenshots, hand them to the server
+	screenshots := make([]string, 0, len(result.Screenshots))
+	for _, name := range result.Screenshots {
+		path := filepath.Join("./screenshots", name)
+		stored, err := r.client.UploadArtifact(execution.ID, path)
+		if err != nil {
+			log.Printf("Failed to upload screenshot %s of execution %d: %v", name, execution.ID, err)
+			continue
+		}
+		os.Remove(path)
+		screenshots = append(screenshots, stored)
+	}
+
+	r.report(execution.ID, ResultRequest{
+		Success:      result.Success,
+		Cancelled:    result.Cancelled,
+		ErrorMessage: result.ErrorMessage,
+		Logs:         result.Logs,
+		Screenshots:  screenshots,
+		Metrics:      result.Metrics,
+	})
+}
+
+// report sends the result of an execution, retrying for as long as the lease
+// would have lasted.
+func (r *Runner) report(executionID uint, result ResultRequest) {
+	deadline := time.Now().Add(r.getLeaseTimeout())
+	for {
+		err := r.client.SendResult(executionID, result)
+		if err == nil {
+			log.Printf("Execution %d finished (success: %v)", executionID, result.Success)
+			return
+		}
+		// The server received it but refused, e.g. because the lease expired
+		var serverErr *ServerError
+		if errors.Is(err, ErrUnauthorized) || errors.As(err, &serverErr) || time.Now().After(deadline) {
+			log.Printf("Giving up reporting the result of execution %d: %v", executionID, err)
+			return
+		}
+
+		log.Printf("Failed to report the result of execution %d, retrying: %v", executionID, err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (r *Runner) finish(executionID uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if cancel, ok := r.running[executionID]; ok {
+		cancel()
+		delete(r.running, executionID)
+	}
+}
+
+func (r *Runner) getLeaseTimeout() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.leaseTimeout
+}
+
+func (r *Runner) runningCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.running)
+}
+
+// handleError logs a failed request. If the server no longer knows the token,
+// for example after the agent was disabled and enabled again, it registers
+// anew.
+func (r *Runner) handleError(action string, err error) {
+	log.Printf("Failed to %s: %v", action, err)
+
+	if errors.Is(err, ErrUnauthorized) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := r.register(ctx); err != nil {
+			log.Printf("Failed to register again: %v", err)
+		}
+	}
+}
+
+func parseDeviceIDs(values []string) []uint {
+	var deviceIDs []uint
+	for _, value := range values {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			log.Printf("Ignoring invalid device ID %q", value)
+			continue
+		}
+		deviceIDs = append(deviceIDs, uint(id))
+	}
+	return deviceIDs
+}
+
+// logStreamer buffers the log entries of a running execution and sends them
+// to the server periodically.
+type logStreamer struct {
+	client      *Client
+	executionID uint
+	mutex       sync.Mutex
+	pending     []executor.ExecutionLog
+	done        chan struct{}
+}
+
+func newLogStreamer(client *Client, executionID uint) *logStreamer {
+	return &logStreamer{client: client, executionID: executionID, done: make(chan struct{})}
+}
+
+func (s *logStreamer) add(entry executor.ExecutionLog) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = append(s.pending, entry)
+}
+
+func (s *logStreamer) run(ctx context.Context) {
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// stop ends streaming. Entries not sent yet are part of the final result.
+func (s *logStreamer) stop() {
+	close(s.done)
+}
+
+func (s *logStreamer) flush() {
+	s.mutex.Lock()
+	logs := s.pending
+	s.pending = nil
+	s.mutex.Unlock()
+
+	if len(logs) == 0 {
+		return
+	}
+	if err := s.client.SendLogs(s.executionID, LogsRequest{Logs: logs}); err != nil {
+		log.Printf("Failed to send logs of execution %d: %v", s.executionID, err)
+	}
+}
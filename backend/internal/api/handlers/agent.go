@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/agent"
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/auth"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var agentRegistrationToken string
+
+// SetAgentRegistrationToken configures the shared secret agents register
+// with. Agents can't register while it is empty.
+func SetAgentRegistrationToken(token string) {
+	agentRegistrationToken = token
+}
+
+func currentAgent(c *gin.Context) *models.Agent {
+	value, _ := c.Get("agent")
+	agent, _ := value.(*models.Agent)
+	return agent
+}
+
+// RegisterAgent registers an agent, or updates it if it registered before, and
+// issues a new token for it.
+func RegisterAgent(c *gin.Context) {
+	if agentRegistrationToken == "" {
+		response.Forbidden(c, "未启用执行代理")
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(agentRegistrationToken)) != 1 {
+		response.Unauthorized(c, "注册令牌无效")
+		return
+	}
+
+	var req agent.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	agentToken, tokenHash, err := auth.GenerateAgentToken()
+	if err != nil {
+		response.InternalServerError(c, "生成代理令牌失败")
+		return
+	}
+
+	deviceIDs, _ := json.Marshal(req.DeviceIDs)
+	browsers, _ := json.Marshal(req.Browsers)
+
+	var registered models.Agent
+	err = database.DB.Where("name = ?", req.Name).First(&registered).Error
+	if err == nil && registered.Status == 0 {
+		response.Forbidden(c, "执行代理已被禁用")
+		return
+	}
+
+	registered.Name = req.Name
+	registered.Hostname = req.Hostname
+	registered.Version = req.Version
+	registered.Capacity = req.Capacity
+	registered.DeviceIDs = string(deviceIDs)
+	registered.Browsers = string(browsers)
+	registered.TokenHash = tokenHash
+	registered.Running = 0
+	registered.Status = 1
+	if err := database.DB.Save(&registered).Error; err != nil {
+		response.InternalServerError(c, "注册执行代理失败")
+		return
+	}
+
+	response.Success(c, agent.RegisterResponse{
+		AgentID:             registered.ID,
+		Token:               agentToken,
+		LeaseTimeoutSeconds: int(executor.GlobalExecutor.LeaseTimeout().Seconds()),
+	})
+}
+
+// AgentHeartbeat renews the leases of the executions an agent is running and
+// tells it which of them to stop.
+func AgentHeartbeat(c *gin.Context) {
+	current := currentAgent(c)
+
+	var req agent.HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	owner := agent.LeaseOwner(current.Name)
+	cancelled := make([]uint, 0)
+	for _, executionID := range req.Running {
+		if !executor.GlobalExecutor.RenewLease(executionID, owner) {
+			cancelled = append(cancelled, executionID)
+		}
+	}
+
+	database.DB.Model(current).Update("running", len(req.Running))
+
+	response.Success(c, agent.HeartbeatResponse{Cancelled: cancelled})
+}
+
+// LeaseExecutions hands queued executions to an agent, up to its free
+// capacity.
+func LeaseExecutions(c *gin.Context) {
+	current := currentAgent(c)
+
+	var req agent.LeaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	owner := agent.LeaseOwner(current.Name)
+
+	var leased int64
+	database.DB.Model(&models.TestExecution{}).Where("status = ? AND lease_owner = ?", "running", owner).Count(&leased)
+
+	slots := req.Slots
+	if free := current.Capacity - int(leased); free < slots {
+		slots = free
+	}
+
+	executions := make([]models.TestExecution, 0)
+	for i := 0; i < slots; i++ {
+		execution := executor.GlobalExecutor.Claim(owner, current.GetDeviceIDs())
+		if execution == nil {
+			break
+		}
+		executions = append(executions, *execution)
+	}
+
+	response.Success(c, agent.LeaseResponse{Executions: executions})
+}
+
+// findLeasedExecution loads an execution leased to the current agent.
+func findLeasedExecution(c *gin.Context) (*models.TestExecution, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的执行记录ID")
+		return nil, false
+	}
+
+	var execution models.TestExecution
+	err = database.DB.Where("id = ? AND lease_owner = ? AND status IN ?", id,
+		agent.LeaseOwner(currentAgent(c).Name), []string{"running", "cancelled"}).First(&execution).Error
+	if err != nil {
+		response.NotFound(c, "执行记录不存在或未租用")
+		return nil, false
+	}
+	return &execution, true
+}
+
+// AppendAgentLogs stores log entries of a running execution as the agent
+// sends them.
+func AppendAgentLogs(c *gin.Context) {
+	execution, ok := findLeasedExecution(c)
+	if !ok {
+		return
+	}
+
+	var req agent.LogsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if !executor.GlobalExecutor.AppendLogs(execution.ID, agent.LeaseOwner(currentAgent(c).Name), req.Logs) {
+		response.BadRequest(c, "执行租约已失效")
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// UploadAgentArtifact stores a screenshot taken by an agent next to the ones
+// taken by local executions.
+func UploadAgentArtifact(c *gin.Context) {
+	execution, ok := findLeasedExecution(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "请选择要上传的文件")
+		return
+	}
+
+	fileName := filepath.Base(fileHeader.Filename)
+	if fileName == "." || fileName == string(filepath.Separator) {
+		response.BadRequest(c, "无效的文件名")
+		return
+	}
+
+	screenshotDir := "./screenshots"
+	if err := os.MkdirAll(screenshotDir, 0755); err != nil {
+		response.InternalServerError(c, "创建截图目录失败")
+		return
+	}
+
+	// Stored under the execution's name space, the agent reports this name
+	fileName = agent.ArtifactName(execution.ID, fileName)
+	if err := c.SaveUploadedFile(fileHeader, filepath.Join(screenshotDir, fileName)); err != nil {
+		response.InternalServerError(c, "保存文件失败")
+		return
+	}
+
+	response.Success(c, agent.ArtifactResponse{FileName: fileName})
+}
+
+// CompleteAgentExecution saves the result of an execution run by an agent.
+func CompleteAgentExecution(c *gin.Context) {
+	execution, ok := findLeasedExecution(c)
+	if !ok {
+		return
+	}
+
+	var req agent.ResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// Only screenshots uploaded for this execution may be referenced
+	screenshots := make([]string, 0, len(req.Screenshots))
+	for _, name := range req.Screenshots {
+		if strings.HasPrefix(name, agent.ArtifactName(execution.ID, "")) && filepath.Base(name) == name {
+			screenshots = append(screenshots, name)
+		}
+	}
+
+	result := executor.ExecutionResult{
+		Success:      req.Success,
+		Cancelled:    req.Cancelled,
+		ErrorMessage: req.ErrorMessage,
+		Logs:         req.Logs,
+		Screenshots:  screenshots,
+		Metrics:      req.Metrics,
+	}
+	if !executor.GlobalExecutor.Complete(execution, agent.LeaseOwner(currentAgent(c).Name), result) {
+		response.BadRequest(c, "执行租约已失效")
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// DownloadAgentFile serves a file attached to the test case of an execution
+// the agent is running, for upload steps.
+func DownloadAgentFile(c *gin.Context) {
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的文件ID")
+		return
+	}
+
+	var file models.TestCaseFile
+	if err := database.DB.First(&file, fileID).Error; err != nil {
+		response.NotFound(c, "文件不存在")
+		return
+	}
+
+	var leased int64
+	database.DB.Model(&models.TestExecution{}).
+		Where("test_case_id = ? AND status = ? AND lease_owner = ?", file.TestCaseID, "running",
+			agent.LeaseOwner(currentAgent(c).Name)).
+		Count(&leased)
+	if leased == 0 {
+		response.Forbidden(c, "无权限下载该文件")
+		return
+	}
+
+	c.FileAttachment(file.FilePath, file.FileName)
+}
+
+// GetAgents lists the registered agents.
+func GetAgents(c *gin.Context) {
+	var agents []models.Agent
+	if err := database.DB.Order("name ASC").Find(&agents).Error; err != nil {
+		response.InternalServerError(c, "获取执行代理失败")
+		return
+	}
+
+	response.Success(c, agents)
+}
+
+// DisableAgent stops an agent from leasing further executions. Executions it
+// is running are recovered once their leases expire.
+func DisableAgent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的执行代理ID")
+		return
+	}
+
+	result := database.DB.Model(&models.Agent{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": 0, "token_hash": ""})
+	if result.Error != nil {
+		response.InternalServerError(c, "禁用执行代理失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFound(c, "执行代理不存在")
+		return
+	}
+
+	response.SuccessWithMessage(c, "禁用成功", nil)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type blackoutRequest struct {
+	Name      string `json:"name" binding:"required,min=1,max=200"`
+	ProjectID *uint  `json:"project_id"` // required, except for global windows which apply to all projects
+	Type      string `json:"type" binding:"required,oneof=weekly dates"`
+	StartDay  int    `json:"start_day"`
+	StartTime string `json:"start_time"`
+	EndDay    int    `json:"end_day"`
+	EndTime   string `json:"end_time"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Timezone  string `json:"timezone" binding:"max=64"`
+}
+
+func GetScheduleBlackouts(c *gin.Context) {
+	projectID := c.Query("project_id")
+
+	query := database.DB.Preload("Project").Where("status = ?", 1)
+	if projectID != "" {
+		query = query.Where("project_id IS NULL OR project_id = ?", projectID)
+	}
+
+	var blackouts []models.ScheduleBlackout
+	if err := query.Order("id").Find(&blackouts).Error; err != nil {
+		response.InternalServerError(c, "获取禁止执行时段失败")
+		return
+	}
+
+	response.Success(c, blackouts)
+}
+
+func CreateScheduleBlackout(c *gin.Context) {
+	createScheduleBlackout(c, false)
+}
+
+// CreateGlobalScheduleBlackout creates a window that applies to every
+// project, it is mounted for admins only.
+func CreateGlobalScheduleBlackout(c *gin.Context) {
+	createScheduleBlackout(c, true)
+}
+
+func UpdateScheduleBlackout(c *gin.Context) {
+	updateScheduleBlackout(c, false)
+}
+
+func UpdateGlobalScheduleBlackout(c *gin.Context) {
+	updateScheduleBlackout(c, true)
+}
+
+func DeleteScheduleBlackout(c *gin.Context) {
+	deleteScheduleBlackout(c, false)
+}
+
+func DeleteGlobalScheduleBlackout(c *gin.Context) {
+	deleteScheduleBlackout(c, true)
+}
+
+func createScheduleBlackout(c *gin.Context, global bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var req blackoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	blackout := models.ScheduleBlackout{
+		Status: 1,
+		UserID: userID.(uint),
+	}
+	if !applyBlackoutRequest(c, &blackout, &req, userID.(uint), global) {
+		return
+	}
+
+	if err := database.DB.Create(&blackout).Error; err != nil {
+		response.InternalServerError(c, "创建禁止执行时段失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "创建成功", blackout)
+}
+
+func updateScheduleBlackout(c *gin.Context, global bool) {
+	blackout, ok := findOwnBlackout(c, global)
+	if !ok {
+		return
+	}
+
+	var req blackoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if !applyBlackoutRequest(c, blackout, &req, blackout.UserID, global) {
+		return
+	}
+
+	if err := database.DB.Save(blackout).Error; err != nil {
+		response.InternalServerError(c, "更新禁止执行时段失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "更新成功", blackout)
+}
+
+func deleteScheduleBlackout(c *gin.Context, global bool) {
+	blackout, ok := findOwnBlackout(c, global)
+	if !ok {
+		return
+	}
+
+	// Soft delete
+	blackout.Status = 0
+	if err := database.DB.Save(blackout).Error; err != nil {
+		response.InternalServerError(c, "删除禁止执行时段失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "删除成功", nil)
+}
+
+// findOwnBlackout loads a project window of the current user or, for admins,
+// any global window.
+func findOwnBlackout(c *gin.Context, global bool) (*models.ScheduleBlackout, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的禁止执行时段ID")
+		return nil, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return nil, false
+	}
+
+	query := database.DB.Where("id = ? AND status = ?", id, 1)
+	if global {
+		query = query.Where("project_id IS NULL")
+	} else {
+		query = query.Where("user_id = ? AND project_id IS NOT NULL", userID)
+	}
+
+	var blackout models.ScheduleBlackout
+	err = query.First(&blackout).Error
+	if err != nil {
+		response.NotFound(c, "禁止执行时段不存在或无权限")
+		return nil, false
+	}
+	return &blackout, true
+}
+
+// applyBlackoutRequest copies and validates the request into blackout. It
+// writes the error response and returns false if the request is invalid.
+func applyBlackoutRequest(c *gin.Context, blackout *models.ScheduleBlackout, req *blackoutRequest, userID uint, global bool) bool {
+	if global {
+		if req.ProjectID != nil {
+			response.BadRequest(c, "全局禁止执行时段不能指定项目")
+			return false
+		}
+	} else {
+		if req.ProjectID == nil {
+			response.BadRequest(c, "请选择项目")
+			return false
+		}
+		var project models.Project
+		err := database.DB.Where("id = ? AND user_id = ? AND status = ?", *req.ProjectID, userID, 1).
+			First(&project).Error
+		if err != nil {
+			response.NotFound(c, "项目不存在或无权限")
+			return false
+		}
+	}
+
+	blackout.Name = req.Name
+	blackout.ProjectID = req.ProjectID
+	blackout.Type = req.Type
+	blackout.StartDay = req.StartDay
+	blackout.StartTime = req.StartTime
+	blackout.EndDay = req.EndDay
+	blackout.EndTime = req.EndTime
+	blackout.StartDate = req.StartDate
+	blackout.EndDate = req.EndDate
+	blackout.Timezone = req.Timezone
+
+	if err := services.ValidateBlackout(blackout); err != nil {
+		response.BadRequest(c, "禁止执行时段无效: "+err.Error())
+		return false
+	}
+	return true
+}
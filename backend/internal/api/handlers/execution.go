@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"autoui-platform/backend/internal/executor"
 	"autoui-platform/backend/internal/models"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/response"
@@ -46,6 +47,7 @@ func GetExecutions(c *gin.Context) {
 	// Clear user passwords
 	for i := range executions {
 		executions[i].User.Password = ""
+		executions[i].QueuePosition = queuePosition(executions[i])
 	}
 
 	response.Page(c, executions, total, page, pageSize)
@@ -69,9 +71,19 @@ func GetExecution(c *gin.Context) {
 	}
 
 	execution.User.Password = ""
+	execution.QueuePosition = queuePosition(execution)
 	response.Success(c, execution)
 }
 
+// queuePosition returns where a pending execution waits for a worker, 0 for
+// executions that are not queued.
+func queuePosition(execution models.TestExecution) int {
+	if execution.Status != "pending" || executor.GlobalExecutor == nil {
+		return 0
+	}
+	return executor.GlobalExecutor.QueuePosition(execution.ID)
+}
+
 func DeleteExecution(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -217,5 +229,10 @@ func StopExecution(c *gin.Context) {
 		return
 	}
 
+	// Close the browser of a running execution and release whoever waits for it
+	if executor.GlobalExecutor != nil {
+		executor.GlobalExecutor.CancelExecution(execution.ID)
+	}
+
 	response.SuccessWithMessage(c, "停止执行成功", nil)
 }
\ No newline at end of file
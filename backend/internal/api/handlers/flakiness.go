@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFlakyTestCases lists the test cases of a project flagged as flaky or
+// quarantined, the flakiest first.
+func GetFlakyTestCases(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的项目ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var project models.Project
+	err = database.DB.Where("id = ? AND user_id = ? AND status = ?", id, userID, 1).First(&project).Error
+	if err != nil {
+		response.NotFound(c, "项目不存在或无权限")
+		return
+	}
+
+	var testCases []models.TestCase
+	err = database.DB.Preload("Environment").
+		Where("project_id = ? AND status = ? AND (is_flaky = ? OR quarantined = ?)", id, 1, true, true).
+		Order("flakiness_score DESC, id ASC").Find(&testCases).Error
+	if err != nil {
+		response.InternalServerError(c, "获取不稳定用例失败")
+		return
+	}
+
+	response.Success(c, testCases)
+}
+
+func QuarantineTestCase(c *gin.Context) {
+	setTestCaseQuarantined(c, true)
+}
+
+func UnquarantineTestCase(c *gin.Context) {
+	setTestCaseQuarantined(c, false)
+}
+
+func setTestCaseQuarantined(c *gin.Context, quarantined bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的测试用例ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var testCase models.TestCase
+	err = database.DB.Where("id = ? AND user_id = ? AND status = ?", id, userID, 1).
+		First(&testCase).Error
+	if err != nil {
+		response.NotFound(c, "测试用例不存在或无权限")
+		return
+	}
+
+	var quarantinedAt *time.Time
+	if quarantined {
+		now := time.Now()
+		quarantinedAt = &now
+	}
+	err = database.DB.Model(&testCase).Updates(map[string]interface{}{
+		"quarantined":    quarantined,
+		"quarantined_at": quarantinedAt,
+	}).Error
+	if err != nil {
+		response.InternalServerError(c, "更新隔离状态失败")
+		return
+	}
+
+	message := "已解除隔离"
+	if quarantined {
+		message = "已隔离"
+	}
+	response.SuccessWithMessage(c, message, gin.H{
+		"test_case_id": testCase.ID,
+		"quarantined":  quarantined,
+	})
+}
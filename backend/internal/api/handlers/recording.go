@@ -3,11 +3,15 @@ package handlers
 import (
 	"autoui-platform/backend/internal/models"
 	"autoui-platform/backend/internal/recorder"
+	"autoui-platform/backend/pkg/auth"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/response"
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -15,15 +19,44 @@ import (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin: checkWebSocketOrigin,
+	// Clients authenticating with the token subprotocol get it echoed back
+	Subprotocols: []string{webSocketTokenProtocol},
+}
+
+var allowedOrigins = map[string]bool{}
+
+// SetAllowedOrigins configures which page origins may open the recording
+// WebSocket. "*" allows any origin.
+func SetAllowedOrigins(origins []string) {
+	allowedOrigins = make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowedOrigins[strings.TrimRight(origin, "/")] = true
+	}
+}
+
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not a browser request, there is no page to protect against
 		return true
-	},
+	}
+	return allowedOrigins["*"] || allowedOrigins[origin]
 }
 
 func StartRecording(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
 	var req struct {
 		TargetURL string `json:"target_url" binding:"required,url"`
 		DeviceID  uint   `json:"device_id" binding:"required"`
+		Headless  bool   `json:"headless"`
+		// Also snapshot cookies and localStorage after the page has loaded
+		CaptureState bool `json:"capture_state"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -50,7 +83,11 @@ func StartRecording(c *gin.Context) {
 	}
 
 	// Start recording
-	err = recorder.Manager.StartRecording(sessionID, req.TargetURL, deviceInfo)
+	err = recorder.Manager.StartRecording(sessionID, req.TargetURL, deviceInfo, recorder.StartOptions{
+		OwnerID:      userID.(uint),
+		Headless:     req.Headless,
+		CaptureState: req.CaptureState,
+	})
 	if err != nil {
 		response.InternalServerError(c, "启动录制失败: "+err.Error())
 		return
@@ -58,6 +95,7 @@ func StartRecording(c *gin.Context) {
 
 	response.SuccessWithMessage(c, "录制已启动", gin.H{
 		"session_id": sessionID,
+		"headless":   req.Headless,
 	})
 }
 
@@ -71,6 +109,10 @@ func StopRecording(c *gin.Context) {
 		return
 	}
 
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
 	err := recorder.Manager.StopRecording(req.SessionID)
 	if err != nil {
 		response.InternalServerError(c, "停止录制失败: "+err.Error())
@@ -80,6 +122,246 @@ func StopRecording(c *gin.Context) {
 	response.SuccessWithMessage(c, "录制已停止", nil)
 }
 
+func PauseRecording(c *gin.Context) {
+	var req struct {
+		SessionID string `json:"session_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	err := recorder.Manager.PauseRecording(req.SessionID)
+	if err != nil {
+		response.BadRequest(c, "暂停录制失败: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "录制已暂停", nil)
+}
+
+func ResumeRecording(c *gin.Context) {
+	var req struct {
+		SessionID string `json:"session_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	err := recorder.Manager.ResumeRecording(req.SessionID)
+	if err != nil {
+		response.BadRequest(c, "恢复录制失败: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "录制已恢复", nil)
+}
+
+func InsertRecordingStep(c *gin.Context) {
+	var req struct {
+		SessionID string              `json:"session_id" binding:"required"`
+		Index     *int                `json:"index"`
+		Step      recorder.RecordStep `json:"step"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	if err := recorder.ValidateStep(req.Step); err != nil {
+		response.BadRequest(c, "步骤无效: "+err.Error())
+		return
+	}
+
+	// Append to the end unless a position is given
+	index := -1
+	if req.Index != nil {
+		index = *req.Index
+	}
+
+	err := recorder.Manager.InsertStep(req.SessionID, index, req.Step)
+	if err != nil {
+		response.BadRequest(c, "插入步骤失败: "+err.Error())
+		return
+	}
+
+	respondRecordingSteps(c, req.SessionID, "插入成功")
+}
+
+func UpdateRecordingStep(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.BadRequest(c, "无效的步骤索引")
+		return
+	}
+
+	var req struct {
+		SessionID string              `json:"session_id" binding:"required"`
+		Step      recorder.RecordStep `json:"step"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	if err := recorder.ValidateStep(req.Step); err != nil {
+		response.BadRequest(c, "步骤无效: "+err.Error())
+		return
+	}
+
+	err = recorder.Manager.UpdateStep(req.SessionID, index, req.Step)
+	if err != nil {
+		response.BadRequest(c, "更新步骤失败: "+err.Error())
+		return
+	}
+
+	respondRecordingSteps(c, req.SessionID, "更新成功")
+}
+
+func DeleteRecordingStep(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.BadRequest(c, "无效的步骤索引")
+		return
+	}
+
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		response.BadRequest(c, "session_id is required")
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, sessionID); !ok {
+		return
+	}
+
+	err = recorder.Manager.DeleteStep(sessionID, index)
+	if err != nil {
+		response.BadRequest(c, "删除步骤失败: "+err.Error())
+		return
+	}
+
+	respondRecordingSteps(c, sessionID, "删除成功")
+}
+
+func MoveRecordingStep(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.BadRequest(c, "无效的步骤索引")
+		return
+	}
+
+	var req struct {
+		SessionID string `json:"session_id" binding:"required"`
+		To        *int   `json:"to" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	err = recorder.Manager.MoveStep(req.SessionID, index, *req.To)
+	if err != nil {
+		response.BadRequest(c, "移动步骤失败: "+err.Error())
+		return
+	}
+
+	respondRecordingSteps(c, req.SessionID, "移动成功")
+}
+
+// ownRecordingSession loads a recording session, which only the user who
+// started it may use.
+func ownRecordingSession(c *gin.Context, sessionID string) (*recorder.ChromeRecorder, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return nil, false
+	}
+
+	chromeRecorder, exists := recorder.Manager.GetRecorder(sessionID)
+	if !exists {
+		response.NotFound(c, "录制会话不存在")
+		return nil, false
+	}
+
+	if chromeRecorder.OwnerID() != userID.(uint) {
+		response.Forbidden(c, "无权限操作该录制会话")
+		return nil, false
+	}
+	return chromeRecorder, true
+}
+
+// respondRecordingSteps replies with the session's step list after an edit.
+func respondRecordingSteps(c *gin.Context, sessionID, message string) {
+	_, steps, err := recorder.Manager.GetRecordingStatus(sessionID)
+	if err != nil {
+		response.NotFound(c, "录制会话不存在")
+		return
+	}
+	if steps == nil {
+		steps = make([]recorder.RecordStep, 0)
+	}
+
+	response.SuccessWithMessage(c, message, gin.H{
+		"steps": steps,
+	})
+}
+
+func SetRecordingAssertMode(c *gin.Context) {
+	var req struct {
+		SessionID     string `json:"session_id" binding:"required"`
+		AssertionType string `json:"assertion_type" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if !recorder.IsValidAssertion(req.AssertionType) {
+		response.BadRequest(c, "不支持的断言类型")
+		return
+	}
+
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
+	err := recorder.Manager.SetAssertMode(req.SessionID, req.AssertionType)
+	if err != nil {
+		response.InternalServerError(c, "设置断言模式失败: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "请在浏览器中点击要断言的元素", nil)
+}
+
 func GetRecordingStatus(c *gin.Context) {
 	sessionID := c.Query("session_id")
 	if sessionID == "" {
@@ -87,6 +369,11 @@ func GetRecordingStatus(c *gin.Context) {
 		return
 	}
 
+	chromeRecorder, ok := ownRecordingSession(c, sessionID)
+	if !ok {
+		return
+	}
+
 	isRecording, steps, err := recorder.Manager.GetRecordingStatus(sessionID)
 	if err != nil {
 		response.NotFound(c, "录制会话不存在")
@@ -98,10 +385,27 @@ func GetRecordingStatus(c *gin.Context) {
 		steps = make([]recorder.RecordStep, 0)
 	}
 
-	response.Success(c, gin.H{
+	data := gin.H{
 		"is_recording": isRecording,
+		"is_paused":    chromeRecorder.IsPaused(),
+		"headless":     chromeRecorder.IsHeadless(),
 		"steps":        steps,
-	})
+	}
+
+	// Raw, uncoalesced events are only returned on request for debugging
+	if c.Query("raw") == "true" {
+		rawSteps, err := recorder.Manager.GetRawSteps(sessionID)
+		if err != nil {
+			response.NotFound(c, "录制会话不存在")
+			return
+		}
+		if rawSteps == nil {
+			rawSteps = make([]recorder.RecordStep, 0)
+		}
+		data["raw_steps"] = rawSteps
+	}
+
+	response.Success(c, data)
 }
 
 func SaveRecording(c *gin.Context) {
@@ -112,15 +416,15 @@ func SaveRecording(c *gin.Context) {
 	}
 
 	var req struct {
-		SessionID        string `json:"session_id" binding:"required"`
-		Name             string `json:"name" binding:"required,min=1,max=200"`
-		Description      string `json:"description" binding:"max=1000"`
-		ProjectID        uint   `json:"project_id" binding:"required"`
-		EnvironmentID    uint   `json:"environment_id" binding:"required"`
-		DeviceID         uint   `json:"device_id" binding:"required"`
-		ExpectedResult   string `json:"expected_result" binding:"max=1000"`
-		Tags             string `json:"tags" binding:"max=500"`
-		Priority         int    `json:"priority" binding:"min=1,max=3"`
+		SessionID      string `json:"session_id" binding:"required"`
+		Name           string `json:"name" binding:"required,min=1,max=200"`
+		Description    string `json:"description" binding:"max=1000"`
+		ProjectID      uint   `json:"project_id" binding:"required"`
+		EnvironmentID  uint   `json:"environment_id" binding:"required"`
+		DeviceID       uint   `json:"device_id" binding:"required"`
+		ExpectedResult string `json:"expected_result" binding:"max=1000"`
+		Tags           string `json:"tags" binding:"max=500"`
+		Priority       int    `json:"priority" binding:"min=1,max=3"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -128,6 +432,10 @@ func SaveRecording(c *gin.Context) {
 		return
 	}
 
+	if _, ok := ownRecordingSession(c, req.SessionID); !ok {
+		return
+	}
+
 	// Verify project exists and user has permission
 	var project models.Project
 	err := database.DB.Where("id = ? AND user_id = ? AND status = ?", req.ProjectID, userID, 1).
@@ -182,11 +490,20 @@ func SaveRecording(c *gin.Context) {
 		return
 	}
 
-	// Get target URL from steps (assuming first step contains it)
-	targetURL := environment.BaseURL
-	if len(steps) > 0 {
-		// In a real implementation, you might store the target URL in the recording session
-		// For now, we'll use the environment base URL
+	// Replays start from the page and browser state the recording started from
+	targetURL, startState, err := recorder.Manager.GetStartInfo(req.SessionID)
+	if err != nil {
+		response.NotFound(c, "录制会话不存在")
+		return
+	}
+	if targetURL == "" {
+		targetURL = environment.BaseURL
+	}
+
+	startStateJSON, err := json.Marshal(startState)
+	if err != nil {
+		response.InternalServerError(c, "保存起始状态失败")
+		return
 	}
 
 	// Create test case
@@ -198,6 +515,7 @@ func SaveRecording(c *gin.Context) {
 		DeviceID:       req.DeviceID,
 		TargetURL:      targetURL,
 		Steps:          string(stepsJSON),
+		StartState:     string(startStateJSON),
 		ExpectedResult: req.ExpectedResult,
 		Tags:           req.Tags,
 		Priority:       req.Priority,
@@ -214,7 +532,7 @@ func SaveRecording(c *gin.Context) {
 	// Load relations for response
 	database.DB.Preload("Project").Preload("Environment").Preload("Device").Preload("User").
 		First(&testCase, testCase.ID)
-	
+
 	// Clear user password
 	testCase.User.Password = ""
 
@@ -224,40 +542,87 @@ func SaveRecording(c *gin.Context) {
 	response.SuccessWithMessage(c, "测试用例保存成功", testCase)
 }
 
+func GetRecordingSessions(c *gin.Context) {
+	sessions := recorder.Manager.ListSessions()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	response.Success(c, sessions)
+}
+
+func CloseRecordingSession(c *gin.Context) {
+	sessionID := c.Param("session_id")
+
+	err := recorder.Manager.CloseSession(sessionID)
+	if err != nil {
+		response.NotFound(c, "录制会话不存在")
+		return
+	}
+
+	response.SuccessWithMessage(c, "录制会话已关闭", nil)
+}
+
 func RecordingWebSocket(c *gin.Context) {
 	sessionID := c.Query("session_id")
 	if sessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "session_id is required"})
 		return
 	}
-	
-	// For WebSocket connections, we can skip authentication since the session itself
-	// is created by authenticated users and serves as implicit authorization
 
-	// Upgrade connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// Browsers can't set an Authorization header on WebSocket requests, so the
+	// JWT comes from the query string or the Sec-WebSocket-Protocol header
+	token := webSocketToken(c.Request)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+		return
+	}
+
+	claims, err := auth.ParseToken(token)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
-	defer conn.Close()
 
 	// Get recorder for session
 	chromeRecorder, exists := recorder.Manager.GetRecorder(sessionID)
 	if !exists {
-		conn.WriteJSON(gin.H{"error": "Recording session not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording session not found"})
+		return
+	}
+
+	if chromeRecorder.OwnerID() != claims.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No permission for this recording session"})
 		return
 	}
 
-	// Set WebSocket connection
-	chromeRecorder.SetWebSocketConnection(conn)
+	// Upgrade connection to WebSocket
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
 
-	// Keep connection alive and handle messages
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
-			break
+	// Stream session updates and handle commands until the client disconnects
+	chromeRecorder.ServeViewer(conn)
+}
+
+// webSocketTokenProtocol is the subprotocol name that precedes the JWT when a
+// client authenticates with new WebSocket(url, ["access_token", token]).
+const webSocketTokenProtocol = "access_token"
+
+// webSocketToken extracts the JWT of a WebSocket handshake.
+func webSocketToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == webSocketTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
 		}
 	}
-}
\ No newline at end of file
+	return ""
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/response"
+	"fmt"
+	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -71,6 +73,59 @@ func GetReport(c *gin.Context) {
 	response.Success(c, report)
 }
 
+// ExportReport downloads a report as a file. The html format is a single
+// page with screenshots embedded, viewable offline; junit and allure are for
+// CI servers to ingest.
+func ExportReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的报告ID")
+		return
+	}
+
+	format := c.DefaultQuery("format", "html")
+	if !exportFormats[format] {
+		response.BadRequest(c, "不支持的导出格式: "+format)
+		return
+	}
+
+	export, err := services.LoadReportExport(uint(id))
+	if err != nil {
+		response.NotFound(c, "测试报告不存在")
+		return
+	}
+
+	writeExport(c, export, format, fmt.Sprintf("report-%d", id))
+}
+
+var exportFormats = map[string]bool{"html": true, "junit": true, "allure": true}
+
+// writeExport renders export in format and sends it as an attachment named
+// after baseName.
+func writeExport(c *gin.Context, export *services.ReportExport, format, baseName string) {
+	var data []byte
+	var err error
+	var fileName, contentType string
+	switch format {
+	case "junit":
+		data, err = services.RenderJUnitReport(export)
+		fileName, contentType = baseName+"-junit.xml", "application/xml; charset=utf-8"
+	case "allure":
+		data, err = services.RenderAllureResults(export)
+		fileName, contentType = baseName+"-allure.zip", "application/zip"
+	default:
+		data, err = services.RenderHTMLReport(export)
+		fileName, contentType = baseName+".html", "text/html; charset=utf-8"
+	}
+	if err != nil {
+		response.InternalServerError(c, "生成报告文件失败: "+err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Data(http.StatusOK, contentType, data)
+}
+
 func CreateReport(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -110,7 +165,7 @@ func CreateReport(c *gin.Context) {
 		}
 	}
 
-	// Verify executions exist and calculate statistics
+	// Verify executions exist
 	var executions []models.TestExecution
 	err = database.DB.Where("id IN ?", req.ExecutionIDs).Find(&executions).Error
 	if err != nil || len(executions) != len(req.ExecutionIDs) {
@@ -118,85 +173,17 @@ func CreateReport(c *gin.Context) {
 		return
 	}
 
-	// Calculate statistics
-	var totalCases, passedCases, failedCases, errorCases int
-	var minStartTime, maxEndTime time.Time
-	var totalDuration int
-
-	for i, execution := range executions {
-		totalCases++
-		
-		switch execution.Status {
-		case "passed":
-			passedCases++
-		case "failed":
-			failedCases++
-		case "error":
-			errorCases++
-		}
-
-		if i == 0 || execution.StartTime.Before(minStartTime) {
-			minStartTime = execution.StartTime
-		}
-
-		if execution.EndTime != nil {
-			if i == 0 || execution.EndTime.After(maxEndTime) {
-				maxEndTime = *execution.EndTime
-			}
-		}
-
-		totalDuration += execution.Duration
-	}
-
-	// Set default end time if no executions have end time
-	if maxEndTime.IsZero() {
-		maxEndTime = time.Now()
-	}
-
-	// Calculate total duration
-	reportDuration := int(maxEndTime.Sub(minStartTime).Seconds())
-	if reportDuration <= 0 {
-		reportDuration = totalDuration
-	}
-
-	// Determine status
-	status := "completed"
-	for _, execution := range executions {
-		if execution.Status == "running" || execution.Status == "pending" {
-			status = "running"
-			break
-		}
-	}
-
-	// Create report
 	report := models.TestReport{
 		Name:        req.Name,
 		ProjectID:   req.ProjectID,
 		TestSuiteID: req.TestSuiteID,
-		TotalCases:  totalCases,
-		PassedCases: passedCases,
-		FailedCases: failedCases,
-		ErrorCases:  errorCases,
-		StartTime:   minStartTime,
-		EndTime:     maxEndTime,
-		Duration:    reportDuration,
-		Status:      status,
 		UserID:      userID.(uint),
 	}
-
-	err = database.DB.Create(&report).Error
-	if err != nil {
+	if err := services.CreateTestReport(&report, executions); err != nil {
 		response.InternalServerError(c, "创建测试报告失败")
 		return
 	}
 
-	// Associate executions with report
-	err = database.DB.Model(&report).Association("Executions").Replace(executions)
-	if err != nil {
-		response.InternalServerError(c, "关联执行记录失败")
-		return
-	}
-
 	// Load relations for response
 	database.DB.Preload("Project").Preload("TestSuite").Preload("User").
 		Preload("Executions").First(&report, report.ID)
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleInfo struct {
+	TestSuiteID    uint                `json:"test_suite_id"`
+	TestSuiteName  string              `json:"test_suite_name"`
+	ProjectID      uint                `json:"project_id"`
+	CronExpression string              `json:"cron_expression"`
+	Timezone       string              `json:"timezone"`
+	Paused         bool                `json:"paused"`
+	NextRuns       []ScheduledRun      `json:"next_runs"`
+	LastRun        *models.ScheduleRun `json:"last_run"`
+	Error          string              `json:"error,omitempty"`
+}
+
+type ScheduledRun struct {
+	Time     time.Time `json:"time"`
+	Blackout string    `json:"blackout,omitempty"` // name of the window the run will be skipped for
+}
+
+// GetSchedules lists every scheduled test suite with its upcoming fire times.
+func GetSchedules(c *gin.Context) {
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "5"))
+	projectID := c.Query("project_id")
+
+	if count <= 0 || count > 50 {
+		count = 5
+	}
+
+	query := database.DB.Where("cron_expression != '' AND cron_expression IS NOT NULL AND status = ?", 1)
+	if projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+
+	var testSuites []models.TestSuite
+	if err := query.Order("id").Find(&testSuites).Error; err != nil {
+		response.InternalServerError(c, "获取定时任务列表失败")
+		return
+	}
+
+	// Last run of every schedule, in one query
+	testSuiteIDs := make([]uint, 0, len(testSuites))
+	for _, testSuite := range testSuites {
+		testSuiteIDs = append(testSuiteIDs, testSuite.ID)
+	}
+	lastRuns := make(map[uint]models.ScheduleRun, len(testSuites))
+	if len(testSuiteIDs) > 0 {
+		latest := database.DB.Model(&models.ScheduleRun{}).Select("test_suite_id, MAX(fired_at)").
+			Where("test_suite_id IN ?", testSuiteIDs).Group("test_suite_id")
+		var runs []models.ScheduleRun
+		database.DB.Where("(test_suite_id, fired_at) IN (?)", latest).Order("id").Find(&runs)
+		for _, run := range runs {
+			lastRuns[run.TestSuiteID] = run
+		}
+	}
+
+	now := time.Now()
+	projectBlackouts := make(map[uint][]models.ScheduleBlackout)
+	schedules := make([]ScheduleInfo, 0, len(testSuites))
+	for _, testSuite := range testSuites {
+		info := ScheduleInfo{
+			TestSuiteID:    testSuite.ID,
+			TestSuiteName:  testSuite.Name,
+			ProjectID:      testSuite.ProjectID,
+			CronExpression: testSuite.CronExpression,
+			Timezone:       testSuite.ScheduleTimezone,
+			Paused:         testSuite.SchedulePaused,
+			NextRuns:       []ScheduledRun{},
+		}
+
+		if !testSuite.SchedulePaused {
+			nextRuns, err := services.NextFireTimes(testSuite.CronExpression, testSuite.ScheduleTimezone, now, count)
+			if err != nil {
+				info.Error = err.Error()
+			}
+
+			blackouts, ok := projectBlackouts[testSuite.ProjectID]
+			if !ok {
+				blackouts, _ = services.ProjectBlackouts(testSuite.ProjectID)
+				projectBlackouts[testSuite.ProjectID] = blackouts
+			}
+			for _, next := range nextRuns {
+				run := ScheduledRun{Time: next}
+				if blackout := services.FindBlackout(blackouts, next); blackout != nil {
+					run.Blackout = blackout.Name
+				}
+				info.NextRuns = append(info.NextRuns, run)
+			}
+		}
+
+		if lastRun, ok := lastRuns[testSuite.ID]; ok {
+			info.LastRun = &lastRun
+		}
+
+		schedules = append(schedules, info)
+	}
+
+	response.Success(c, schedules)
+}
+
+func PauseSchedule(c *gin.Context) {
+	setSchedulePaused(c, true)
+}
+
+func ResumeSchedule(c *gin.Context) {
+	setSchedulePaused(c, false)
+}
+
+func setSchedulePaused(c *gin.Context, paused bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的测试套件ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var testSuite models.TestSuite
+	err = database.DB.Where("id = ? AND user_id = ? AND status = ?", id, userID, 1).
+		First(&testSuite).Error
+	if err != nil {
+		response.NotFound(c, "测试套件不存在或无权限")
+		return
+	}
+
+	if testSuite.CronExpression == "" {
+		response.BadRequest(c, "该测试套件未设置定时表达式")
+		return
+	}
+
+	if err := services.SetSchedulePaused(&testSuite, paused); err != nil {
+		response.InternalServerError(c, "更新定时任务失败: "+err.Error())
+		return
+	}
+
+	message := "定时任务已恢复"
+	if paused {
+		message = "定时任务已暂停"
+	}
+	response.SuccessWithMessage(c, message, gin.H{
+		"test_suite_id": testSuite.ID,
+		"paused":        testSuite.SchedulePaused,
+	})
+}
+
+// GetScheduleRuns returns the history of schedule triggers of a test suite,
+// including the ones that didn't start any execution.
+func GetScheduleRuns(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的测试套件ID")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	status := c.Query("status")
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	var runs []models.ScheduleRun
+	var total int64
+
+	query := database.DB.Model(&models.ScheduleRun{}).Where("test_suite_id = ?", id)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	err = query.Order("fired_at DESC").Offset(offset).Limit(pageSize).Find(&runs).Error
+	if err != nil {
+		response.InternalServerError(c, "获取定时执行记录失败")
+		return
+	}
+
+	response.Page(c, runs, total, page, pageSize)
+}
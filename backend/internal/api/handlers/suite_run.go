@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetSuiteRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	testSuiteID := c.Query("test_suite_id")
+	projectID := c.Query("project_id")
+	status := c.Query("status")
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	var runs []models.SuiteRun
+	var total int64
+
+	query := database.DB.Model(&models.SuiteRun{})
+	if testSuiteID != "" {
+		query = query.Where("test_suite_id = ?", testSuiteID)
+	}
+	if projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	err := query.Preload("TestSuite").Preload("Environment").Preload("User").
+		Order("id DESC").Offset(offset).Limit(pageSize).Find(&runs).Error
+	if err != nil {
+		response.InternalServerError(c, "获取套件执行记录失败")
+		return
+	}
+
+	for i := range runs {
+		runs[i].User.Password = ""
+	}
+
+	response.Page(c, runs, total, page, pageSize)
+}
+
+// GetSuiteRun returns a suite run with all of its executions, retried
+// attempts included.
+func GetSuiteRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的套件执行ID")
+		return
+	}
+
+	var run models.SuiteRun
+	err = database.DB.Preload("TestSuite").Preload("Environment").Preload("User").
+		Preload("Executions", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Executions.TestCase").
+		First(&run, id).Error
+	if err != nil {
+		response.NotFound(c, "套件执行记录不存在")
+		return
+	}
+
+	run.User.Password = ""
+	for i := range run.Executions {
+		run.Executions[i].QueuePosition = queuePosition(run.Executions[i])
+	}
+	response.Success(c, run)
+}
+
+// ExportSuiteRun downloads the results of a suite run in the same formats as
+// reports, so CI can fetch them right after the run without a report.
+func ExportSuiteRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的套件执行ID")
+		return
+	}
+
+	format := c.DefaultQuery("format", "html")
+	if !exportFormats[format] {
+		response.BadRequest(c, "不支持的导出格式: "+format)
+		return
+	}
+
+	export, err := services.LoadSuiteRunExport(uint(id))
+	if err != nil {
+		response.NotFound(c, "套件执行记录不存在")
+		return
+	}
+
+	writeExport(c, export, format, fmt.Sprintf("suite-run-%d", id))
+}
+
+// findOwnedSuiteRun loads a suite run of a test suite the current user may
+// execute.
+func findOwnedSuiteRun(c *gin.Context) (*models.SuiteRun, uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的套件执行ID")
+		return nil, 0, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return nil, 0, false
+	}
+
+	var run models.SuiteRun
+	err = database.DB.Preload("TestSuite").Preload("TestSuite.Project").First(&run, id).Error
+	if err != nil {
+		response.NotFound(c, "套件执行记录不存在")
+		return nil, 0, false
+	}
+
+	if run.UserID != userID.(uint) && run.TestSuite.UserID != userID.(uint) &&
+		run.TestSuite.Project.UserID != userID.(uint) {
+		response.Forbidden(c, "无权限操作该套件执行")
+		return nil, 0, false
+	}
+	return &run, userID.(uint), true
+}
+
+func StopSuiteRun(c *gin.Context) {
+	run, _, ok := findOwnedSuiteRun(c)
+	if !ok {
+		return
+	}
+
+	if run.Status != "running" {
+		response.BadRequest(c, "只能停止运行中的套件执行")
+		return
+	}
+
+	stoppedCount := services.CancelSuiteRun(run.ID)
+
+	response.SuccessWithMessage(c, "套件执行已停止", gin.H{
+		"stopped_count": stoppedCount,
+	})
+}
+
+// RerunFailedSuiteRun starts a new run of the test cases that failed in a
+// finished suite run.
+func RerunFailedSuiteRun(c *gin.Context) {
+	run, userID, ok := findOwnedSuiteRun(c)
+	if !ok {
+		return
+	}
+
+	if run.Status == "running" {
+		response.BadRequest(c, "套件执行尚未结束")
+		return
+	}
+
+	rerun, err := services.RerunFailedTestCases(run, userID)
+	if err != nil {
+		response.BadRequest(c, "重新执行失败用例失败: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "失败用例已重新执行", rerun)
+}
@@ -3,11 +3,11 @@ package handlers
 import (
 	"autoui-platform/backend/internal/executor"
 	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/response"
 	"encoding/json"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -70,6 +70,8 @@ func CreateTestCase(c *gin.Context) {
 		ExpectedResult string                `json:"expected_result" binding:"max=1000"`
 		Tags           string                `json:"tags" binding:"max=500"`
 		Priority       int                   `json:"priority" binding:"min=1,max=3"`
+		RetryMaxAttempts int                 `json:"retry_max_attempts" binding:"min=0,max=10"` // 0 uses the suite's retry policy
+		RetryOn        string                `json:"retry_on" binding:"max=200"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -77,6 +79,11 @@ func CreateTestCase(c *gin.Context) {
 		return
 	}
 
+	if err := executor.ValidateRetryOn(req.RetryOn); err != nil {
+		response.BadRequest(c, "重试错误类型无效: "+err.Error())
+		return
+	}
+
 	// Verify project exists and user has permission
 	var project models.Project
 	err := database.DB.Where("id = ? AND user_id = ? AND status = ?", req.ProjectID, userID, 1).
@@ -130,6 +137,8 @@ func CreateTestCase(c *gin.Context) {
 		ExpectedResult: req.ExpectedResult,
 		Tags:           req.Tags,
 		Priority:       req.Priority,
+		RetryMaxAttempts: req.RetryMaxAttempts,
+		RetryOn:        req.RetryOn,
 		Status:         1,
 		UserID:         userID.(uint),
 	}
@@ -156,7 +165,7 @@ func GetTestCase(c *gin.Context) {
 	}
 
 	var testCase models.TestCase
-	err = database.DB.Preload("Project").Preload("Environment").Preload("Device").Preload("User").
+	err = database.DB.Preload("Project").Preload("Environment").Preload("Device").Preload("User").Preload("Files").
 		Where("status = ?", 1).First(&testCase, id).Error
 	if err != nil {
 		response.NotFound(c, "测试用例不存在")
@@ -191,6 +200,8 @@ func UpdateTestCase(c *gin.Context) {
 		ExpectedResult string            `json:"expected_result" binding:"max=1000"`
 		Tags           string            `json:"tags" binding:"max=500"`
 		Priority       int               `json:"priority" binding:"omitempty,min=1,max=3"`
+		RetryMaxAttempts *int            `json:"retry_max_attempts" binding:"omitempty,min=0,max=10"`
+		RetryOn        *string           `json:"retry_on" binding:"omitempty,max=200"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -198,6 +209,13 @@ func UpdateTestCase(c *gin.Context) {
 		return
 	}
 
+	if req.RetryOn != nil {
+		if err := executor.ValidateRetryOn(*req.RetryOn); err != nil {
+			response.BadRequest(c, "重试错误类型无效: "+err.Error())
+			return
+		}
+	}
+
 	var testCase models.TestCase
 	err = database.DB.Where("id = ? AND user_id = ? AND status = ?", id, userID, 1).
 		First(&testCase).Error
@@ -268,6 +286,12 @@ func UpdateTestCase(c *gin.Context) {
 	if req.Priority > 0 {
 		testCase.Priority = req.Priority
 	}
+	if req.RetryMaxAttempts != nil {
+		testCase.RetryMaxAttempts = *req.RetryMaxAttempts
+	}
+	if req.RetryOn != nil {
+		testCase.RetryOn = *req.RetryOn
+	}
 
 	// Update steps if provided
 	if req.Steps != nil {
@@ -344,7 +368,7 @@ func ExecuteTestCase(c *gin.Context) {
 	}
 
 	var testCase models.TestCase
-	err = database.DB.Preload("Project").Preload("Environment").Preload("Device").
+	err = database.DB.Preload("Project").Preload("Environment").Preload("Device").Preload("Files").
 		Where("id = ? AND status = ?", id, 1).First(&testCase).Error
 	if err != nil {
 		response.NotFound(c, "测试用例不存在")
@@ -363,71 +387,18 @@ func ExecuteTestCase(c *gin.Context) {
 		return
 	}
 
-	runningCount := executor.GlobalExecutor.GetRunningCount()
-	if runningCount >= 10 { // Max concurrent executions
-		response.BadRequest(c, "当前并发执行数已达上限，请稍后再试")
-		return
-	}
-
-	// Create execution record
-	execution := models.TestExecution{
-		TestCaseID:    testCase.ID,
-		ExecutionType: "test_case",
-		Status:        "pending",
-		StartTime:     time.Now(),
-		UserID:        userID.(uint),
-		ErrorMessage:  "",
-		ExecutionLogs: "[]",
-		Screenshots:   "[]",
-	}
-
-	err = database.DB.Create(&execution).Error
+	// Execute test case asynchronously (default to visual execution). It waits
+	// in the queue while every worker is busy.
+	execution, err := services.StartTestCaseRun(testCase, userID.(uint), true)
 	if err != nil {
 		response.InternalServerError(c, "创建执行记录失败")
 		return
 	}
 
-	// Update status to running
-	execution.Status = "running"
-	database.DB.Save(&execution)
-
-	// Execute test case asynchronously (default to visual execution)
-	go func() {
-		resultChan := executor.GlobalExecutor.ExecuteTestCaseWithOptions(&execution, &testCase, true)
-		result := <-resultChan
-
-		// Update execution with result
-		if result.Success {
-			execution.Status = "passed"
-		} else {
-			execution.Status = "failed"
-			execution.ErrorMessage = result.ErrorMessage
-		}
-
-		now := time.Now()
-		execution.EndTime = &now
-		execution.Duration = int(now.Sub(execution.StartTime).Seconds())
-
-		// Save logs and screenshots
-		if logsJSON, err := json.Marshal(result.Logs); err == nil {
-			execution.ExecutionLogs = string(logsJSON)
-		}
-		if screenshotsJSON, err := json.Marshal(result.Screenshots); err == nil {
-			execution.Screenshots = string(screenshotsJSON)
-		}
-
-		database.DB.Save(&execution)
-
-		// Save performance metrics if available
-		if result.Metrics != nil {
-			result.Metrics.ExecutionID = execution.ID
-			database.DB.Create(result.Metrics)
-		}
-	}()
-
 	// Load execution with relations for response
 	database.DB.Preload("TestCase").Preload("User").First(&execution, execution.ID)
 	execution.User.Password = ""
+	execution.QueuePosition = executor.GlobalExecutor.QueuePosition(execution.ID)
 
 	response.SuccessWithMessage(c, "测试执行已启动", execution)
 }
\ No newline at end of file
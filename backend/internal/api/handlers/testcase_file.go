@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"autoui-platform/backend/pkg/response"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	testCaseFileDir     = "./uploads/test-cases"
+	maxTestCaseFileSize = 50 << 20
+)
+
+// findOwnTestCase loads an active test case of the current user for handlers
+// that modify it.
+func findOwnTestCase(c *gin.Context) (*models.TestCase, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的测试用例ID")
+		return nil, false
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		response.Unauthorized(c, "用户未登录")
+		return nil, false
+	}
+
+	var testCase models.TestCase
+	err = database.DB.Where("id = ? AND user_id = ? AND status = ?", id, userID, 1).
+		First(&testCase).Error
+	if err != nil {
+		response.NotFound(c, "测试用例不存在或无权限")
+		return nil, false
+	}
+	return &testCase, true
+}
+
+func GetTestCaseFiles(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的测试用例ID")
+		return
+	}
+
+	var files []models.TestCaseFile
+	database.DB.Where("test_case_id = ?", id).Order("file_name").Find(&files)
+
+	response.Success(c, files)
+}
+
+// UploadTestCaseFile attaches a file to a test case for its upload steps. A
+// file with the same name replaces the previous one, since steps refer to
+// files by name.
+func UploadTestCaseFile(c *gin.Context) {
+	testCase, ok := findOwnTestCase(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "请选择要上传的文件")
+		return
+	}
+	if fileHeader.Size > maxTestCaseFileSize {
+		response.BadRequest(c, fmt.Sprintf("文件大小不能超过%dMB", maxTestCaseFileSize>>20))
+		return
+	}
+
+	fileName := filepath.Base(fileHeader.Filename)
+	dir := filepath.Join(testCaseFileDir, strconv.FormatUint(uint64(testCase.ID), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		response.InternalServerError(c, "创建上传目录失败")
+		return
+	}
+
+	filePath := filepath.Join(dir, uuid.New().String()+filepath.Ext(fileName))
+	if err := c.SaveUploadedFile(fileHeader, filePath); err != nil {
+		response.InternalServerError(c, "保存文件失败")
+		return
+	}
+
+	var existing []models.TestCaseFile
+	database.DB.Where("test_case_id = ? AND file_name = ?", testCase.ID, fileName).Find(&existing)
+	for _, file := range existing {
+		removeTestCaseFile(&file)
+	}
+
+	file := models.TestCaseFile{
+		TestCaseID: testCase.ID,
+		FileName:   fileName,
+		FilePath:   filePath,
+		FileSize:   fileHeader.Size,
+		UserID:     testCase.UserID,
+	}
+	if err := database.DB.Create(&file).Error; err != nil {
+		os.Remove(filePath)
+		response.InternalServerError(c, "保存文件记录失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "上传成功", file)
+}
+
+func DeleteTestCaseFile(c *gin.Context) {
+	testCase, ok := findOwnTestCase(c)
+	if !ok {
+		return
+	}
+
+	var file models.TestCaseFile
+	err := database.DB.Where("id = ? AND test_case_id = ?", c.Param("file_id"), testCase.ID).First(&file).Error
+	if err != nil {
+		response.NotFound(c, "文件不存在")
+		return
+	}
+
+	if err := removeTestCaseFile(&file); err != nil {
+		response.InternalServerError(c, "删除文件失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "删除成功", nil)
+}
+
+func removeTestCaseFile(file *models.TestCaseFile) error {
+	if err := database.DB.Delete(file).Error; err != nil {
+		return err
+	}
+	if err := os.Remove(file.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove test case file %s: %v", file.FilePath, err)
+	}
+	return nil
+}
@@ -3,11 +3,11 @@ package handlers
 import (
 	"autoui-platform/backend/internal/executor"
 	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/internal/services"
 	"autoui-platform/backend/pkg/database"
 	"autoui-platform/backend/pkg/response"
-	"encoding/json"
+	"log"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -69,8 +69,13 @@ func CreateTestSuite(c *gin.Context) {
 		Tags            string `json:"tags" binding:"max=500"`
 		Priority        int    `json:"priority" binding:"min=1,max=3"`
 		CronExpression  string `json:"cron_expression" binding:"max=100"`
+		ScheduleTimezone string `json:"schedule_timezone" binding:"max=64"`
+		OverlapPolicy   string `json:"overlap_policy" binding:"omitempty,oneof=skip queue_one cancel_previous"`
+		MissedRunPolicy string `json:"missed_run_policy" binding:"omitempty,oneof=skip run_once"`
 		IsParallel      bool   `json:"is_parallel"`
 		TimeoutMinutes  int    `json:"timeout_minutes" binding:"min=1,max=1440"`
+		RetryMaxAttempts int   `json:"retry_max_attempts" binding:"omitempty,min=1,max=10"`
+		RetryOn         string `json:"retry_on" binding:"max=200"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -78,6 +83,19 @@ func CreateTestSuite(c *gin.Context) {
 		return
 	}
 
+	if err := executor.ValidateRetryOn(req.RetryOn); err != nil {
+		response.BadRequest(c, "重试错误类型无效: "+err.Error())
+		return
+	}
+	if req.RetryMaxAttempts == 0 {
+		req.RetryMaxAttempts = 1
+	}
+
+	if err := services.ValidateSchedule(req.CronExpression, req.ScheduleTimezone); err != nil {
+		response.BadRequest(c, "定时表达式无效: "+err.Error())
+		return
+	}
+
 	// Verify project exists and user has permission
 	var project models.Project
 	err := database.DB.Where("id = ? AND user_id = ? AND status = ?", req.ProjectID, userID, 1).
@@ -123,8 +141,13 @@ func CreateTestSuite(c *gin.Context) {
 		Tags:           req.Tags,
 		Priority:       req.Priority,
 		CronExpression: req.CronExpression,
+		ScheduleTimezone: req.ScheduleTimezone,
+		OverlapPolicy:  req.OverlapPolicy,
+		MissedRunPolicy: req.MissedRunPolicy,
 		IsParallel:     req.IsParallel,
 		TimeoutMinutes: req.TimeoutMinutes,
+		RetryMaxAttempts: req.RetryMaxAttempts,
+		RetryOn:        req.RetryOn,
 		Status:         1,
 		UserID:         userID.(uint),
 		TestCases:      testCases,
@@ -145,6 +168,10 @@ func CreateTestSuite(c *gin.Context) {
 		}
 	}
 
+	if err := services.AddSchedule(testSuite); err != nil {
+		log.Printf("Failed to schedule test suite %d: %v", testSuite.ID, err)
+	}
+
 	// Load relations for response
 	database.DB.Preload("Project").Preload("Environment").Preload("User").Preload("TestCases").
 		First(&testSuite, testSuite.ID)
@@ -194,9 +221,14 @@ func UpdateTestSuite(c *gin.Context) {
 		TestCaseIDs     []uint `json:"test_case_ids"`
 		Tags            string `json:"tags" binding:"max=500"`
 		Priority        int    `json:"priority" binding:"min=1,max=3"`
-		CronExpression  string `json:"cron_expression" binding:"max=100"`
+		CronExpression  *string `json:"cron_expression" binding:"omitempty,max=100"` // empty string removes the schedule
+		ScheduleTimezone *string `json:"schedule_timezone" binding:"omitempty,max=64"`
+		OverlapPolicy   string `json:"overlap_policy" binding:"omitempty,oneof=skip queue_one cancel_previous"`
+		MissedRunPolicy string `json:"missed_run_policy" binding:"omitempty,oneof=skip run_once"`
 		IsParallel      bool   `json:"is_parallel"`
 		TimeoutMinutes  int    `json:"timeout_minutes" binding:"min=1,max=1440"`
+		RetryMaxAttempts int   `json:"retry_max_attempts" binding:"omitempty,min=1,max=10"`
+		RetryOn         *string `json:"retry_on" binding:"omitempty,max=200"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -212,6 +244,26 @@ func UpdateTestSuite(c *gin.Context) {
 		return
 	}
 
+	if req.RetryOn != nil {
+		if err := executor.ValidateRetryOn(*req.RetryOn); err != nil {
+			response.BadRequest(c, "重试错误类型无效: "+err.Error())
+			return
+		}
+	}
+	if req.CronExpression != nil || req.ScheduleTimezone != nil {
+		cronExpression, timezone := testSuite.CronExpression, testSuite.ScheduleTimezone
+		if req.CronExpression != nil {
+			cronExpression = *req.CronExpression
+		}
+		if req.ScheduleTimezone != nil {
+			timezone = *req.ScheduleTimezone
+		}
+		if err := services.ValidateSchedule(cronExpression, timezone); err != nil {
+			response.BadRequest(c, "定时表达式无效: "+err.Error())
+			return
+		}
+	}
+
 	// Check name uniqueness if updating
 	if req.Name != "" && req.Name != testSuite.Name {
 		var existingTestSuite models.TestSuite
@@ -244,13 +296,31 @@ func UpdateTestSuite(c *gin.Context) {
 	if req.Priority != 0 {
 		testSuite.Priority = req.Priority
 	}
-	if req.CronExpression != "" {
-		testSuite.CronExpression = req.CronExpression
+	// Missed runs are only looked for anew when the timing changed
+	timingChanged := (req.CronExpression != nil && *req.CronExpression != testSuite.CronExpression) ||
+		(req.ScheduleTimezone != nil && *req.ScheduleTimezone != testSuite.ScheduleTimezone)
+	if req.CronExpression != nil {
+		testSuite.CronExpression = *req.CronExpression
+	}
+	if req.ScheduleTimezone != nil {
+		testSuite.ScheduleTimezone = *req.ScheduleTimezone
+	}
+	if req.OverlapPolicy != "" {
+		testSuite.OverlapPolicy = req.OverlapPolicy
+	}
+	if req.MissedRunPolicy != "" {
+		testSuite.MissedRunPolicy = req.MissedRunPolicy
 	}
 	testSuite.IsParallel = req.IsParallel
 	if req.TimeoutMinutes != 0 {
 		testSuite.TimeoutMinutes = req.TimeoutMinutes
 	}
+	if req.RetryMaxAttempts != 0 {
+		testSuite.RetryMaxAttempts = req.RetryMaxAttempts
+	}
+	if req.RetryOn != nil {
+		testSuite.RetryOn = *req.RetryOn
+	}
 
 	// Update test cases if provided
 	if req.TestCaseIDs != nil {
@@ -271,12 +341,19 @@ func UpdateTestSuite(c *gin.Context) {
 		}
 	}
 
-	err = database.DB.Save(&testSuite).Error
+	// The run state columns belong to the scheduler, which may have changed
+	// them since the suite was loaded
+	err = database.DB.Omit("run_state", "run_started_at", "queued_run_at", "last_fired_at").
+		Save(&testSuite).Error
 	if err != nil {
 		response.InternalServerError(c, "更新测试套件失败")
 		return
 	}
 
+	if err := services.UpdateSchedule(testSuite, timingChanged); err != nil {
+		log.Printf("Failed to reschedule test suite %d: %v", testSuite.ID, err)
+	}
+
 	// Load relations for response
 	database.DB.Preload("Project").Preload("Environment").Preload("User").Preload("TestCases").
 		First(&testSuite, testSuite.ID)
@@ -315,13 +392,14 @@ func DeleteTestSuite(c *gin.Context) {
 	}
 
 	// Soft delete
-	testSuite.Status = 0
-	err = database.DB.Save(&testSuite).Error
+	err = database.DB.Model(&testSuite).Update("status", 0).Error
 	if err != nil {
 		response.InternalServerError(c, "删除测试套件失败")
 		return
 	}
 
+	services.RemoveSchedule(testSuite.ID)
+
 	response.SuccessWithMessage(c, "删除成功", nil)
 }
 
@@ -340,11 +418,13 @@ func ExecuteTestSuite(c *gin.Context) {
 
 	// Parse request body for execution options
 	var req struct {
-		IsVisual bool `json:"is_visual"`
+		IsVisual bool   `json:"is_visual"`
+		Trigger  string `json:"trigger" binding:"omitempty,oneof=manual api"` // api for runs started by CI or scripts
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		// If no body provided, default to visual execution
 		req.IsVisual = true
+		req.Trigger = ""
 	}
 
 	var testSuite models.TestSuite
@@ -372,87 +452,22 @@ func ExecuteTestSuite(c *gin.Context) {
 		return
 	}
 
-	runningCount := executor.GlobalExecutor.GetRunningCount()
-	if runningCount + len(testSuite.TestCases) > 10 {
-		response.BadRequest(c, "当前并发执行数不足以运行整个测试套件，请稍后再试")
+	run, err := services.StartSuiteRun(testSuite, services.SuiteRunOptions{
+		UserID:   userID.(uint),
+		IsVisual: req.IsVisual,
+		Trigger:  req.Trigger,
+	})
+	if err != nil {
+		response.InternalServerError(c, "创建执行记录失败")
 		return
 	}
-
-	var executions []models.TestExecution
-
-	// Create execution records for all test cases
-	for _, testCase := range testSuite.TestCases {
-		execution := models.TestExecution{
-			TestCaseID:    testCase.ID,
-			TestSuiteID:   &testSuite.ID,
-			ExecutionType: "test_suite",
-			Status:        "pending",
-			StartTime:     time.Now(),
-			UserID:        userID.(uint),
-			ErrorMessage:  "",
-			ExecutionLogs: "[]",
-			Screenshots:   "[]",
-		}
-
-		err = database.DB.Create(&execution).Error
-		if err != nil {
-			response.InternalServerError(c, "创建执行记录失败")
-			return
-		}
-
-		executions = append(executions, execution)
-	}
-
-	// Execute all test cases asynchronously
-	go func() {
-		for i, execution := range executions {
-			execution.Status = "running"
-			database.DB.Save(&execution)
-
-			// Load test case with relations
-			var testCase models.TestCase
-			database.DB.Preload("Environment").Preload("Device").
-				First(&testCase, execution.TestCaseID)
-
-			resultChan := executor.GlobalExecutor.ExecuteTestCaseWithOptions(&execution, &testCase, req.IsVisual)
-			result := <-resultChan
-
-			// Update execution with result
-			if result.Success {
-				execution.Status = "passed"
-			} else {
-				execution.Status = "failed"
-				execution.ErrorMessage = result.ErrorMessage
-			}
-
-			now := time.Now()
-			execution.EndTime = &now
-			execution.Duration = int(now.Sub(execution.StartTime).Seconds())
-
-			// Save logs and screenshots
-			if logsJSON, err := json.Marshal(result.Logs); err == nil {
-				execution.ExecutionLogs = string(logsJSON)
-			}
-			if screenshotsJSON, err := json.Marshal(result.Screenshots); err == nil {
-				execution.Screenshots = string(screenshotsJSON)
-			}
-
-			database.DB.Save(&execution)
-
-			// Save performance metrics if available
-			if result.Metrics != nil {
-				result.Metrics.ExecutionID = execution.ID
-				database.DB.Create(result.Metrics)
-			}
-
-			executions[i] = execution
-		}
-	}()
+	executions := run.Executions
 
 	// Load executions with relations for response
 	for i := range executions {
 		database.DB.Preload("TestCase").Preload("User").First(&executions[i], executions[i].ID)
 		executions[i].User.Password = ""
+		executions[i].QueuePosition = executor.GlobalExecutor.QueuePosition(executions[i].ID)
 	}
 
 	response.SuccessWithMessage(c, "测试套件执行已启动", executions)
@@ -484,30 +499,24 @@ func StopTestSuite(c *gin.Context) {
 		return
 	}
 
-	// Find all running or pending executions for this test suite
-	var executions []models.TestExecution
-	err = database.DB.Where("test_suite_id = ? AND (status = ? OR status = ?)", 
-		id, "running", "pending").Find(&executions).Error
+	// Only the runs in progress are stopped, not older leftovers of the suite
+	var running int64
+	err = database.DB.Model(&models.SuiteRun{}).Where("test_suite_id = ? AND status = ?", id, "running").
+		Count(&running).Error
 	if err != nil {
 		response.InternalServerError(c, "查询执行记录失败")
 		return
 	}
 
-	if len(executions) == 0 {
+	if running == 0 {
 		response.BadRequest(c, "没有正在运行的执行记录")
 		return
 	}
 
-	// Stop all running/pending executions
-	err = database.DB.Model(&models.TestExecution{}).
-		Where("test_suite_id = ? AND (status = ? OR status = ?)", id, "running", "pending").
-		Updates(models.TestExecution{Status: "cancelled"}).Error
-	if err != nil {
-		response.InternalServerError(c, "停止测试套件执行失败")
-		return
-	}
+	// Stop their running/pending executions, including the browsers of running ones
+	stoppedCount := services.CancelSuiteRuns(testSuite.ID)
 
 	response.SuccessWithMessage(c, "测试套件执行已停止", gin.H{
-		"stopped_count": len(executions),
+		"stopped_count": stoppedCount,
 	})
 }
\ No newline at end of file
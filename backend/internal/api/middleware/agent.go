@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/auth"
+	"autoui-platform/backend/pkg/database"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AgentAuthMiddleware authenticates execution agents by the token they got
+// when registering and records that they were seen.
+func AgentAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Authorization header format must be Bearer {token}",
+			})
+			c.Abort()
+			return
+		}
+
+		var agent models.Agent
+		err := database.DB.Where("token_hash = ? AND status = ?", auth.HashAgentToken(parts[1]), 1).First(&agent).Error
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Invalid agent token",
+			})
+			c.Abort()
+			return
+		}
+
+		now := time.Now()
+		database.DB.Model(&agent).Update("last_seen_at", &now)
+
+		c.Set("agent", &agent)
+		c.Next()
+	}
+}
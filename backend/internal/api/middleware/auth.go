@@ -46,6 +46,29 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware only lets the configured admin users through. It must run
+// after AuthMiddleware.
+func AdminMiddleware(adminUsernames []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(adminUsernames))
+	for _, username := range adminUsernames {
+		admins[username] = true
+	}
+
+	return func(c *gin.Context) {
+		username, _ := c.Get("username")
+		if name, ok := username.(string); !ok || !admins[name] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "Admin privileges required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
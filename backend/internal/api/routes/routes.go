@@ -28,9 +28,25 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 		// Health check
 		v1.GET("/health", handlers.HealthCheck)
 		
-		// WebSocket endpoint (no auth middleware for WebSocket)
+		// WebSocket endpoint, authenticates with a token in the handshake since
+		// browsers can't send the Authorization header
+		handlers.SetAllowedOrigins(cfg.Server.AllowedOrigins)
 		v1.GET("/ws/recording", handlers.RecordingWebSocket)
 
+		// Execution agents, authenticate with the token issued at registration
+		handlers.SetAgentRegistrationToken(cfg.Agent.RegistrationToken)
+		v1.POST("/agent/register", handlers.RegisterAgent)
+		agentAPI := v1.Group("/agent")
+		agentAPI.Use(middleware.AgentAuthMiddleware())
+		{
+			agentAPI.POST("/heartbeat", handlers.AgentHeartbeat)
+			agentAPI.POST("/lease", handlers.LeaseExecutions)
+			agentAPI.POST("/executions/:id/logs", handlers.AppendAgentLogs)
+			agentAPI.POST("/executions/:id/artifacts", handlers.UploadAgentArtifact)
+			agentAPI.POST("/executions/:id/result", handlers.CompleteAgentExecution)
+			agentAPI.GET("/files/:file_id", handlers.DownloadAgentFile)
+		}
+
 		// Protected routes (auth required)
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware())
@@ -61,6 +77,7 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 				projects.GET("/:id", handlers.GetProject)
 				projects.PUT("/:id", handlers.UpdateProject)
 				projects.DELETE("/:id", handlers.DeleteProject)
+				projects.GET("/:id/flaky-test-cases", handlers.GetFlakyTestCases)
 			}
 
 			// Device management
@@ -82,6 +99,11 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 				testCases.PUT("/:id", handlers.UpdateTestCase)
 				testCases.DELETE("/:id", handlers.DeleteTestCase)
 				testCases.POST("/:id/execute", handlers.ExecuteTestCase)
+				testCases.POST("/:id/quarantine", handlers.QuarantineTestCase)
+				testCases.POST("/:id/unquarantine", handlers.UnquarantineTestCase)
+				testCases.GET("/:id/files", handlers.GetTestCaseFiles)
+				testCases.POST("/:id/files", handlers.UploadTestCaseFile)
+				testCases.DELETE("/:id/files/:file_id", handlers.DeleteTestCaseFile)
 			}
 
 			// Test suite management
@@ -94,9 +116,45 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 				testSuites.DELETE("/:id", handlers.DeleteTestSuite)
 				testSuites.POST("/:id/execute", handlers.ExecuteTestSuite)
 				testSuites.POST("/:id/stop", handlers.StopTestSuite)
+				testSuites.GET("/:id/schedule-runs", handlers.GetScheduleRuns)
+			}
+
+			// Scheduled test suites
+			schedules := protected.Group("/schedules")
+			{
+				schedules.GET("", handlers.GetSchedules)
+				schedules.POST("/:id/pause", handlers.PauseSchedule)
+				schedules.POST("/:id/resume", handlers.ResumeSchedule)
+			}
+
+			// Periods in which scheduled runs are skipped
+			blackouts := protected.Group("/schedule-blackouts")
+			{
+				blackouts.GET("", handlers.GetScheduleBlackouts)
+				blackouts.POST("", handlers.CreateScheduleBlackout)
+				blackouts.PUT("/:id", handlers.UpdateScheduleBlackout)
+				blackouts.DELETE("/:id", handlers.DeleteScheduleBlackout)
+
+				// Windows applying to every project are managed by admins only
+				global := blackouts.Group("/global")
+				global.Use(middleware.AdminMiddleware(cfg.Admin.Usernames))
+				{
+					global.POST("", handlers.CreateGlobalScheduleBlackout)
+					global.PUT("/:id", handlers.UpdateGlobalScheduleBlackout)
+					global.DELETE("/:id", handlers.DeleteGlobalScheduleBlackout)
+				}
 			}
 
 			// Test execution and reporting
+			suiteRuns := protected.Group("/suite-runs")
+			{
+				suiteRuns.GET("", handlers.GetSuiteRuns)
+				suiteRuns.GET("/:id", handlers.GetSuiteRun)
+				suiteRuns.GET("/:id/export", handlers.ExportSuiteRun)
+				suiteRuns.POST("/:id/stop", handlers.StopSuiteRun)
+				suiteRuns.POST("/:id/rerun-failed", handlers.RerunFailedSuiteRun)
+			}
+
 			executions := protected.Group("/executions")
 			{
 				executions.GET("", handlers.GetExecutions)
@@ -112,6 +170,7 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 			{
 				reports.GET("", handlers.GetReports)
 				reports.GET("/:id", handlers.GetReport)
+				reports.GET("/:id/export", handlers.ExportReport)
 				reports.DELETE("/:id", handlers.DeleteReport)
 				reports.POST("", handlers.CreateReport)
 			}
@@ -123,6 +182,29 @@ func SetupRoutes(cfg *config.Config) *gin.Engine {
 				recording.POST("/stop", handlers.StopRecording)
 				recording.GET("/status", handlers.GetRecordingStatus)
 				recording.POST("/save", handlers.SaveRecording)
+				recording.POST("/assert", handlers.SetRecordingAssertMode)
+				recording.POST("/pause", handlers.PauseRecording)
+				recording.POST("/resume", handlers.ResumeRecording)
+				recording.POST("/steps", handlers.InsertRecordingStep)
+				recording.PUT("/steps/:index", handlers.UpdateRecordingStep)
+				recording.DELETE("/steps/:index", handlers.DeleteRecordingStep)
+				recording.POST("/steps/:index/move", handlers.MoveRecordingStep)
+
+				// Session administration
+				sessions := recording.Group("/sessions")
+				sessions.Use(middleware.AdminMiddleware(cfg.Admin.Usernames))
+				{
+					sessions.GET("", handlers.GetRecordingSessions)
+					sessions.DELETE("/:session_id", handlers.CloseRecordingSession)
+				}
+			}
+
+			// Execution agent administration
+			agents := protected.Group("/agents")
+			agents.Use(middleware.AdminMiddleware(cfg.Admin.Usernames))
+			{
+				agents.GET("", handlers.GetAgents)
+				agents.DELETE("/:id", handlers.DisableAgent)
 			}
 
 			// WebSocket moved to public routes above
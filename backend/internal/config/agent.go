@@ -0,0 +1,26 @@
+package config
+
+import "os"
+
+// RunnerConfig configures the agent binary that runs executions for a server.
+type RunnerConfig struct {
+	ServerURL         string // Base URL of the server API, e.g. http://localhost:8080/api/v1
+	RegistrationToken string
+	Name              string
+	Capacity          int      // Executions run at the same time
+	DeviceIDs         []string // Devices to run executions for, empty for all
+	Headless          bool     // Run every execution headless, even if it asks to be visual
+}
+
+func LoadRunnerConfig() *RunnerConfig {
+	hostname, _ := os.Hostname()
+
+	return &RunnerConfig{
+		ServerURL:         getEnv("AGENT_SERVER_URL", "http://localhost:8080/api/v1"),
+		RegistrationToken: getEnv("AGENT_REGISTRATION_TOKEN", ""),
+		Name:              getEnv("AGENT_NAME", hostname),
+		Capacity:          getEnvAsInt("AGENT_CAPACITY", 2),
+		DeviceIDs:         getEnvAsSlice("AGENT_DEVICE_IDS", nil),
+		Headless:          getEnvAsBool("AGENT_HEADLESS", true),
+	}
+}
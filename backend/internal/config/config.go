@@ -4,13 +4,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Chrome   ChromeConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Chrome    ChromeConfig
+	Executor  ExecutorConfig
+	Agent     AgentConfig
+	Recording RecordingConfig
+	Scheduler SchedulerConfig
+	Flakiness FlakinessConfig
+	Admin     AdminConfig
 }
 
 type ServerConfig struct {
@@ -19,6 +26,10 @@ type ServerConfig struct {
 	Mode         string
 	ReadTimeout  int
 	WriteTimeout int
+	// Page origins allowed to open WebSocket connections, "*" for any
+	AllowedOrigins []string
+	// Running executions get this long to finish on shutdown before they are interrupted
+	ShutdownGraceSeconds int
 }
 
 type DatabaseConfig struct {
@@ -41,6 +52,34 @@ type ChromeConfig struct {
 	DebugPort    int
 }
 
+type ExecutorConfig struct {
+	LeaseTimeoutSeconds int  // A running execution without a heartbeat for this long is considered stale
+	RequeueStale        bool // Run stale executions again once instead of marking them interrupted
+}
+
+type AgentConfig struct {
+	RegistrationToken string // Shared secret agents register with, empty disables agents
+}
+
+type RecordingConfig struct {
+	IdleTimeoutMinutes int // Close sessions without activity after this long, 0 disables
+	MaxLifetimeMinutes int // Close sessions older than this, 0 disables
+}
+
+type SchedulerConfig struct {
+	CatchUpWindowMinutes int // Runs missed while the backend was down longer ago than this are not caught up, 0 disables catch-up
+}
+
+type FlakinessConfig struct {
+	Threshold float64 // Test cases scoring at least this, from 0 to 1, are flagged as flaky
+	Window    int     // Number of recent executions the score covers
+	MinRuns   int     // Test cases with fewer executions are not flagged
+}
+
+type AdminConfig struct {
+	Usernames []string // Users allowed to manage platform-wide resources, nobody when unset
+}
+
 func LoadConfig() (*Config, error) {
 	config := &Config{
 		Server: ServerConfig{
@@ -49,6 +88,11 @@ func LoadConfig() (*Config, error) {
 			Mode:         getEnv("SERVER_MODE", "debug"),
 			ReadTimeout:  getEnvAsInt("SERVER_READ_TIMEOUT", 30),
 			WriteTimeout: getEnvAsInt("SERVER_WRITE_TIMEOUT", 30),
+			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", []string{
+				"http://localhost:3000",
+				"http://localhost",
+			}),
+			ShutdownGraceSeconds: getEnvAsInt("SHUTDOWN_GRACE_SECONDS", 60),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -67,6 +111,28 @@ func LoadConfig() (*Config, error) {
 			MaxInstances: getEnvAsInt("CHROME_MAX_INSTANCES", 10),
 			DebugPort:    getEnvAsInt("CHROME_DEBUG_PORT", 9222),
 		},
+		Executor: ExecutorConfig{
+			LeaseTimeoutSeconds: getEnvAsInt("EXECUTOR_LEASE_TIMEOUT_SECONDS", 90),
+			RequeueStale:        getEnvAsBool("EXECUTOR_REQUEUE_STALE", true),
+		},
+		Agent: AgentConfig{
+			RegistrationToken: getEnv("AGENT_REGISTRATION_TOKEN", ""),
+		},
+		Recording: RecordingConfig{
+			IdleTimeoutMinutes: getEnvAsInt("RECORDING_IDLE_TIMEOUT_MINUTES", 30),
+			MaxLifetimeMinutes: getEnvAsInt("RECORDING_MAX_LIFETIME_MINUTES", 240),
+		},
+		Scheduler: SchedulerConfig{
+			CatchUpWindowMinutes: getEnvAsInt("SCHEDULER_CATCHUP_WINDOW_MINUTES", 60),
+		},
+		Flakiness: FlakinessConfig{
+			Threshold: getEnvAsFloat("FLAKY_THRESHOLD", 0.2),
+			Window:    getEnvAsInt("FLAKY_WINDOW", 20),
+			MinRuns:   getEnvAsInt("FLAKY_MIN_RUNS", 5),
+		},
+		Admin: AdminConfig{
+			Usernames: getEnvAsSlice("ADMIN_USERNAMES", nil),
+		},
 	}
 	
 	return config, nil
@@ -99,6 +165,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -106,4 +181,19 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 		}
 	}
 	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
\ No newline at end of file
@@ -3,6 +3,7 @@ package executor
 import (
 	"autoui-platform/backend/internal/models"
 	"autoui-platform/backend/pkg/chrome"
+	"autoui-platform/backend/pkg/database"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -13,33 +14,38 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 )
 
 type TestExecutor struct {
-	ctx        context.Context
-	cancel     context.CancelFunc
-	device     models.Device
-	maxWorkers int
-	workQueue  chan ExecutionJob
-	wg         sync.WaitGroup
-	mutex      sync.RWMutex
-	running    map[uint]bool
-}
-
-type ExecutionJob struct {
-	Execution  *models.TestExecution
-	TestCase   *models.TestCase
-	IsVisual   bool
-	ResultChan chan ExecutionResult
+	ctx          context.Context
+	cancel       context.CancelFunc
+	device       models.Device
+	maxWorkers   int
+	instanceID   string        // lease owner of the executions claimed by this process
+	leaseTimeout time.Duration // a running execution without a heartbeat for this long is stale
+	requeueStale bool
+	wake         chan struct{} // nudges idle workers when an execution is queued
+	stop         chan struct{}
+	stopped      bool
+	wg           sync.WaitGroup
+	mutex        sync.RWMutex
+	running      map[uint]bool
+	cancels      map[uint]context.CancelFunc // stops the browser of a started execution
+	waiters      map[uint]chan ExecutionResult
+	onFinish     func(testCaseID uint) // called once an execution has its final result
 }
 
 type ExecutionResult struct {
+	ExecutionID  uint // the execution that produced the result, the last attempt if it was retried
 	Success      bool
+	Cancelled    bool
 	ErrorMessage string
 	Screenshots  []string
 	Logs         []ExecutionLog
 	Metrics      *models.PerformanceMetric
+	onLog        func(ExecutionLog)
 }
 
 type ExecutionLog struct {
@@ -51,55 +57,103 @@ type ExecutionLog struct {
 
 var GlobalExecutor *TestExecutor
 
-func InitExecutor(maxWorkers int) {
+// InitExecutor starts maxWorkers workers, so at most that many browsers run
+// test cases at the same time in this process; 0 leaves execution to agents.
+// Executions wait in the database until a worker claims them, so queued work
+// survives a restart. Executions left running by a previous process are
+// recovered first.
+func InitExecutor(maxWorkers int, leaseTimeout time.Duration, requeueStale bool) {
+	if maxWorkers < 0 {
+		maxWorkers = 0
+	}
+	if leaseTimeout <= 0 {
+		leaseTimeout = 90 * time.Second
+	}
+
 	GlobalExecutor = &TestExecutor{
-		maxWorkers: maxWorkers,
-		workQueue:  make(chan ExecutionJob, maxWorkers*2),
-		running:    make(map[uint]bool),
+		maxWorkers:   maxWorkers,
+		instanceID:   newInstanceID(),
+		leaseTimeout: leaseTimeout,
+		requeueStale: requeueStale,
+		wake:         make(chan struct{}, maxWorkers+1),
+		stop:         make(chan struct{}),
+		running:      make(map[uint]bool),
+		cancels:      make(map[uint]context.CancelFunc),
+		waiters:      make(map[uint]chan ExecutionResult),
 	}
 
+	GlobalExecutor.recoverStale(true)
+	go GlobalExecutor.reapStale()
+
 	// Start worker goroutines
 	for i := 0; i < maxWorkers; i++ {
 		go GlobalExecutor.worker()
 	}
 
-	log.Printf("Test executor initialized with %d workers", maxWorkers)
+	if maxWorkers == 0 {
+		log.Printf("Test executor %s initialized without local workers, executions run on agents", GlobalExecutor.instanceID)
+		return
+	}
+	log.Printf("Test executor %s initialized with %d workers", GlobalExecutor.instanceID, maxWorkers)
 }
 
 func (te *TestExecutor) worker() {
-	for job := range te.workQueue {
-		// Execute the test case
-		result := te.executeTestCase(job.TestCase, job.IsVisual)
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
 
-		// Mark execution as completed
-		te.mutex.Lock()
-		delete(te.running, job.Execution.ID)
-		te.mutex.Unlock()
+	for {
+		if te.isStopped() {
+			return
+		}
 
-		// Send result
-		job.ResultChan <- result
-	}
-}
+		execution := te.Claim(te.instanceID, nil)
+		if execution == nil {
+			select {
+			case <-te.wake:
+			case <-ticker.C:
+			case <-te.stop:
+				return
+			}
+			continue
+		}
 
-func (te *TestExecutor) ExecuteTestCase(execution *models.TestExecution, testCase *models.TestCase) <-chan ExecutionResult {
-	return te.ExecuteTestCaseWithOptions(execution, testCase, false)
+		te.run(execution)
+	}
 }
 
-func (te *TestExecutor) ExecuteTestCaseWithOptions(execution *models.TestExecution, testCase *models.TestCase, isVisual bool) <-chan ExecutionResult {
+// run executes a claimed execution while keeping its lease alive, then saves
+// the result and hands it to whoever waits for it.
+func (te *TestExecutor) run(execution *models.TestExecution) {
+	ctx, cancel := context.WithCancel(context.Background())
 	te.mutex.Lock()
 	te.running[execution.ID] = true
+	te.cancels[execution.ID] = cancel
 	te.mutex.Unlock()
 
-	resultChan := make(chan ExecutionResult, 1)
-	job := ExecutionJob{
-		Execution:  execution,
-		TestCase:   testCase,
-		IsVisual:   isVisual,
-		ResultChan: resultChan,
+	go te.keepLease(ctx, execution.ID, cancel)
+
+	// Execute the test case
+	result := te.executeTestCase(ctx, &execution.TestCase, RunOptions{IsVisual: execution.IsVisual})
+	if ctx.Err() != nil {
+		result.Success = false
+		result.Cancelled = true
+		result.ErrorMessage = "Execution cancelled"
 	}
 
-	te.workQueue <- job
-	return resultChan
+	// Mark execution as completed
+	te.mutex.Lock()
+	delete(te.running, execution.ID)
+	delete(te.cancels, execution.ID)
+	te.mutex.Unlock()
+	cancel()
+
+	te.Complete(execution, te.instanceID, result)
+}
+
+func (te *TestExecutor) isStopped() bool {
+	te.mutex.RLock()
+	defer te.mutex.RUnlock()
+	return te.stopped
 }
 
 func (te *TestExecutor) IsRunning(executionID uint) bool {
@@ -114,10 +168,27 @@ func (te *TestExecutor) GetRunningCount() int {
 	return len(te.running)
 }
 
-func (te *TestExecutor) executeTestCase(testCase *models.TestCase, isVisual bool) ExecutionResult {
+// RunOptions controls how a single test case is run.
+type RunOptions struct {
+	IsVisual bool
+	// OnLog, if set, is called with every log entry as it is written
+	OnLog func(ExecutionLog)
+}
+
+// RunTestCase runs a test case in a new browser without the queue. The test
+// case must be loaded with its environment, device and files. Screenshots are
+// written to ./screenshots and listed by file name in the result.
+func RunTestCase(ctx context.Context, testCase *models.TestCase, options RunOptions) ExecutionResult {
+	te := &TestExecutor{}
+	return te.executeTestCase(ctx, testCase, options)
+}
+
+func (te *TestExecutor) executeTestCase(parent context.Context, testCase *models.TestCase, options RunOptions) ExecutionResult {
+	isVisual := options.IsVisual
 	result := ExecutionResult{
 		Screenshots: make([]string, 0),
 		Logs:        make([]ExecutionLog, 0),
+		onLog:       options.OnLog,
 	}
 
 	// Parse test steps
@@ -170,7 +241,7 @@ func (te *TestExecutor) executeTestCase(testCase *models.TestCase, isVisual bool
 		// Remove WindowSize and UserAgent as we'll use DevTools device emulation
 	)
 
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	allocCtx, cancel := chromedp.NewExecAllocator(parent, opts...)
 	defer cancel()
 
 	ctx, cancel := chromedp.NewContext(allocCtx)
@@ -191,6 +262,18 @@ func (te *TestExecutor) executeTestCase(testCase *models.TestCase, isVisual bool
 		result.addLog("info", "Device viewport emulation enabled", -1)
 	}
 
+	// Restore the browser state the test case was recorded from
+	startState, err := testCase.GetStartState()
+	if err != nil {
+		result.addLog("warn", fmt.Sprintf("Failed to parse start state: %v", err), -1)
+	} else if startState != nil {
+		if err := applyStartState(ctx, startState, testCase.Device.ID == 0); err != nil {
+			result.addLog("warn", fmt.Sprintf("Failed to restore start state: %v", err), -1)
+		} else {
+			result.addLog("info", fmt.Sprintf("Restored start state: %d cookies, %d localStorage items", len(startState.Cookies), len(startState.LocalStorage)), -1)
+		}
+	}
+
 	// Navigate to target URL
 	result.addLog("info", "Navigating to target URL: "+testCase.TargetURL, -1)
 	err = chromedp.Run(ctx, chromedp.Navigate(testCase.TargetURL))
@@ -233,11 +316,19 @@ func (te *TestExecutor) executeTestCase(testCase *models.TestCase, isVisual bool
 		result.Screenshots = append(result.Screenshots, screenshotPath)
 	}
 
+	// Clicks that open a file chooser must not block on the native dialog,
+	// upload steps set the files directly
+	if hasUploadStep(steps) {
+		if err := chromedp.Run(ctx, page.SetInterceptFileChooserDialog(true)); err != nil {
+			result.addLog("warn", fmt.Sprintf("Failed to intercept file chooser: %v", err), -1)
+		}
+	}
+
 	// Execute test steps
 	for i, step := range steps {
 		result.addLog("info", fmt.Sprintf("Executing step %d: %s", i+1, step.Type), i)
 
-		err = te.executeStep(ctx, step, i)
+		err = te.executeStep(ctx, testCase, step, i)
 		if err != nil {
 			result.ErrorMessage = fmt.Sprintf("Step %d failed: %v", i+1, err)
 			result.addLog("error", result.ErrorMessage, i)
@@ -280,10 +371,20 @@ func (te *TestExecutor) executeTestCase(testCase *models.TestCase, isVisual bool
 	return result
 }
 
-func (te *TestExecutor) executeStep(ctx context.Context, step models.TestStep, stepIndex int) error {
+func (te *TestExecutor) executeStep(ctx context.Context, testCase *models.TestCase, step models.TestStep, stepIndex int) error {
 	switch step.Type {
 	case "click":
 		return te.executeClick(ctx, step)
+	case "dblclick":
+		return te.executeDoubleClick(ctx, step)
+	case "contextmenu":
+		return te.executeContextMenu(ctx, step)
+	case "hover":
+		return te.executeHover(ctx, step)
+	case "drag":
+		return te.executeDrag(ctx, step)
+	case "upload":
+		return te.executeUpload(ctx, testCase, step)
 	case "input":
 		return te.executeInput(ctx, step)
 	case "keydown":
@@ -296,6 +397,13 @@ func (te *TestExecutor) executeStep(ctx context.Context, step models.TestStep, s
 		return te.executeChange(ctx, step)
 	case "submit":
 		return te.executeSubmit(ctx, step)
+	case "assert":
+		return te.executeAssert(ctx, step)
+	case "wait":
+		return te.executeWait(ctx, step)
+	case "comment":
+		// Comments only document the recording
+		return nil
 	default:
 		return fmt.Errorf("unsupported step type: %s", step.Type)
 	}
@@ -363,6 +471,77 @@ func (te *TestExecutor) executeSubmit(ctx context.Context, step models.TestStep)
 	)
 }
 
+func (te *TestExecutor) executeWait(ctx context.Context, step models.TestStep) error {
+	// Duration is given in milliseconds, either as the step value or the "duration" option
+	duration, _ := step.Options["duration"].(float64)
+	if duration <= 0 {
+		duration = parseFloat(step.Value)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("wait step requires a positive duration")
+	}
+
+	return chromedp.Run(ctx, chromedp.Sleep(time.Duration(duration)*time.Millisecond))
+}
+
+func (te *TestExecutor) executeAssert(ctx context.Context, step models.TestStep) error {
+	assertion, _ := step.Options["assertion"].(string)
+
+	// Assertions fail fast instead of waiting for the overall execution timeout
+	assertCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	switch assertion {
+	case "exists":
+		if err := chromedp.Run(assertCtx, chromedp.WaitReady(step.Selector, chromedp.ByQuery)); err != nil {
+			return fmt.Errorf("assertion failed: element %s does not exist", step.Selector)
+		}
+	case "visible":
+		if err := chromedp.Run(assertCtx, chromedp.WaitVisible(step.Selector, chromedp.ByQuery)); err != nil {
+			return fmt.Errorf("assertion failed: element %s is not visible", step.Selector)
+		}
+	case "text":
+		var text string
+		err := chromedp.Run(assertCtx,
+			chromedp.WaitVisible(step.Selector, chromedp.ByQuery),
+			chromedp.Text(step.Selector, &text, chromedp.ByQuery),
+		)
+		if err != nil {
+			return fmt.Errorf("assertion failed: cannot read text of %s: %v", step.Selector, err)
+		}
+		if !matchAssertValue(step, text) {
+			return fmt.Errorf("assertion failed: text of %s is %q, expected %q", step.Selector, strings.TrimSpace(text), step.Value)
+		}
+	case "value":
+		var value string
+		err := chromedp.Run(assertCtx,
+			chromedp.WaitReady(step.Selector, chromedp.ByQuery),
+			chromedp.Value(step.Selector, &value, chromedp.ByQuery),
+		)
+		if err != nil {
+			return fmt.Errorf("assertion failed: cannot read value of %s: %v", step.Selector, err)
+		}
+		if !matchAssertValue(step, value) {
+			return fmt.Errorf("assertion failed: value of %s is %q, expected %q", step.Selector, value, step.Value)
+		}
+	default:
+		return fmt.Errorf("unsupported assertion type: %s", assertion)
+	}
+
+	return nil
+}
+
+// matchAssertValue compares actual against the recorded value, either exactly
+// or as a substring when the step's "match" option is "contains".
+func matchAssertValue(step models.TestStep, actual string) bool {
+	actual = strings.TrimSpace(actual)
+	expected := strings.TrimSpace(step.Value)
+	if match, _ := step.Options["match"].(string); match == "contains" {
+		return strings.Contains(actual, expected)
+	}
+	return actual == expected
+}
+
 func (te *TestExecutor) takeScreenshot(ctx context.Context, stepType string, stepIndex int) string {
 	timestamp := time.Now().Format("20060102_150405")
 	filename := fmt.Sprintf("%s_%s_%d_%s.png", stepType, timestamp, stepIndex, generateRandomString(8))
@@ -501,12 +680,17 @@ func parseFloat(s string) float64 {
 }
 
 func (result *ExecutionResult) addLog(level, message string, stepIndex int) {
-	result.Logs = append(result.Logs, ExecutionLog{
+	entry := ExecutionLog{
 		Timestamp: time.Now(),
 		Level:     level,
 		Message:   message,
 		StepIndex: stepIndex,
-	})
+	}
+	result.Logs = append(result.Logs, entry)
+
+	if result.onLog != nil {
+		result.onLog(entry)
+	}
 }
 
 func generateRandomString(length int) string {
@@ -518,14 +702,23 @@ func generateRandomString(length int) string {
 	return string(result)
 }
 
-// Stop gracefully shuts down the executor
+// OnFinish registers fn to be called with the test case of every execution
+// that finished, passed or failed, after its last attempt.
+func (te *TestExecutor) OnFinish(fn func(testCaseID uint)) {
+	te.onFinish = fn
+}
+
+// Stop shuts down the executor. Workers no longer claim executions; queued
+// executions stay in the database and are picked up after a restart.
 func (te *TestExecutor) Stop() {
 	te.mutex.Lock()
 	defer te.mutex.Unlock()
 
-	if te.workQueue != nil {
-		close(te.workQueue)
+	if te.stopped {
+		return
 	}
+	te.stopped = true
+	close(te.stop)
 
 	if te.cancel != nil {
 		te.cancel()
@@ -534,6 +727,59 @@ func (te *TestExecutor) Stop() {
 	log.Println("Test executor stopped")
 }
 
+// Shutdown stops claiming executions and waits up to grace for the running
+// ones to finish. Executions still running after that are stopped and marked
+// interrupted. Queued executions stay in the database for the next start.
+func (te *TestExecutor) Shutdown(grace time.Duration) {
+	te.Stop()
+
+	if count := te.GetRunningCount(); count > 0 {
+		log.Printf("Waiting up to %v for %d running executions to finish", grace, count)
+	}
+	if te.waitRunning(grace) {
+		return
+	}
+
+	te.mutex.Lock()
+	cancels := make(map[uint]context.CancelFunc, len(te.cancels))
+	for executionID, cancel := range te.cancels {
+		cancels[executionID] = cancel
+	}
+	te.mutex.Unlock()
+
+	message := "Execution interrupted: the server shut down"
+	for executionID, cancel := range cancels {
+		now := time.Now()
+		database.DB.Model(&models.TestExecution{}).
+			Where("id = ? AND status = ? AND lease_owner = ?", executionID, "running", te.instanceID).
+			Updates(map[string]interface{}{
+				"status":           "interrupted",
+				"error_message":    message,
+				"end_time":         &now,
+				"lease_expires_at": nil,
+			})
+		te.notify(executionID, ExecutionResult{ErrorMessage: message})
+		cancel()
+		log.Printf("Execution %d interrupted by shutdown", executionID)
+	}
+
+	// Give the browsers a moment to close
+	te.waitRunning(10 * time.Second)
+}
+
+// waitRunning waits up to timeout for running executions to finish and
+// reports whether they did.
+func (te *TestExecutor) waitRunning(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for te.GetRunningCount() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return true
+}
+
 // GetExecutionStatus returns the current status of an execution
 func (te *TestExecutor) GetExecutionStatus(executionID uint) string {
 	te.mutex.RLock()
@@ -542,16 +788,27 @@ func (te *TestExecutor) GetExecutionStatus(executionID uint) string {
 	if te.running[executionID] {
 		return "running"
 	}
+	if _, ok := te.waiters[executionID]; ok {
+		return "queued"
+	}
 	return "completed"
 }
 
-// CancelExecution cancels a running execution
+// CancelExecution cancels a queued or running execution; the caller marks it
+// cancelled in the database. A running execution has its browser closed, a
+// queued one reports a cancelled result to its waiter right away.
 func (te *TestExecutor) CancelExecution(executionID uint) bool {
 	te.mutex.Lock()
-	defer te.mutex.Unlock()
+	cancel, running := te.cancels[executionID]
+	te.mutex.Unlock()
 
-	if te.running[executionID] {
-		delete(te.running, executionID)
+	if running {
+		cancel()
+		log.Printf("Execution %d cancelled", executionID)
+		return true
+	}
+
+	if te.notify(executionID, ExecutionResult{Cancelled: true, ErrorMessage: "Execution cancelled"}) {
 		log.Printf("Execution %d cancelled", executionID)
 		return true
 	}
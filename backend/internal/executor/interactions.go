@@ -0,0 +1,246 @@
+package executor
+
+import (
+	"autoui-platform/backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// Default time to rest on an element for hover steps without a recorded dwell
+	defaultHoverDwell = 500 * time.Millisecond
+	// Pointer drags are replayed as this many intermediate moves so that
+	// libraries tracking mousemove see a continuous gesture
+	dragMoveSteps = 10
+)
+
+func (te *TestExecutor) executeDoubleClick(ctx context.Context, step models.TestStep) error {
+	err := chromedp.Run(ctx,
+		chromedp.WaitVisible(step.Selector, chromedp.ByQuery),
+		chromedp.DoubleClick(step.Selector, chromedp.ByQuery),
+		chromedp.Sleep(200*time.Millisecond),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to double-click element %s: %v", step.Selector, err)
+	}
+	return nil
+}
+
+func (te *TestExecutor) executeContextMenu(ctx context.Context, step models.TestStep) error {
+	x, y, err := elementCenter(ctx, step.Selector)
+	if err != nil {
+		return err
+	}
+
+	err = chromedp.Run(ctx,
+		chromedp.MouseClickXY(x, y, chromedp.ButtonType(input.Right)),
+		chromedp.Sleep(200*time.Millisecond),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to right-click element %s: %v", step.Selector, err)
+	}
+	return nil
+}
+
+func (te *TestExecutor) executeHover(ctx context.Context, step models.TestStep) error {
+	x, y, err := elementCenter(ctx, step.Selector)
+	if err != nil {
+		return err
+	}
+
+	dwell := defaultHoverDwell
+	if millis, ok := step.Options["dwell"].(float64); ok && millis > 0 {
+		dwell = time.Duration(millis) * time.Millisecond
+	}
+
+	err = chromedp.Run(ctx,
+		chromedp.MouseEvent(input.MouseMoved, x, y),
+		chromedp.Sleep(dwell),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to hover element %s: %v", step.Selector, err)
+	}
+	return nil
+}
+
+// executeDrag replays a drag of the step element onto the element in the
+// "target" option. HTML5 drags are dispatched as drag events since CDP mouse
+// input doesn't start native drag and drop, pointer drags as mouse input.
+func (te *TestExecutor) executeDrag(ctx context.Context, step models.TestStep) error {
+	target, _ := step.Options["target"].(string)
+	mode, _ := step.Options["mode"].(string)
+
+	if mode == "html5" {
+		if target == "" {
+			return fmt.Errorf("drag step requires a target")
+		}
+		return te.executeHTML5Drag(ctx, step.Selector, target)
+	}
+
+	fromX, fromY, err := elementCenter(ctx, step.Selector)
+	if err != nil {
+		return err
+	}
+
+	// Without a distinct drop target, e.g. for sliders, the recorded offset is
+	// replayed relative to the element
+	var toX, toY float64
+	dx, hasDX := step.Coordinates["dx"].(float64)
+	dy, hasDY := step.Coordinates["dy"].(float64)
+	if (target == "" || target == step.Selector) && (hasDX || hasDY) {
+		toX, toY = fromX+dx, fromY+dy
+	} else if target != "" {
+		if toX, toY, err = elementCenter(ctx, target); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("drag step requires a target or offset")
+	}
+
+	actions := []chromedp.Action{
+		chromedp.MouseEvent(input.MouseMoved, fromX, fromY),
+		chromedp.MouseEvent(input.MousePressed, fromX, fromY, chromedp.ButtonLeft, chromedp.ClickCount(1)),
+	}
+	for i := 1; i <= dragMoveSteps; i++ {
+		progress := float64(i) / dragMoveSteps
+		actions = append(actions, chromedp.MouseEvent(input.MouseMoved,
+			fromX+(toX-fromX)*progress, fromY+(toY-fromY)*progress, chromedp.ButtonLeft))
+	}
+	actions = append(actions,
+		chromedp.MouseEvent(input.MouseReleased, toX, toY, chromedp.ButtonLeft, chromedp.ClickCount(1)),
+		chromedp.Sleep(200*time.Millisecond),
+	)
+
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		return fmt.Errorf("failed to drag element %s: %v", step.Selector, err)
+	}
+	return nil
+}
+
+func (te *TestExecutor) executeHTML5Drag(ctx context.Context, source, target string) error {
+	sourceJSON, _ := json.Marshal(source)
+	targetJSON, _ := json.Marshal(target)
+
+	script := fmt.Sprintf(`(function() {
+	const source = document.querySelector(%s);
+	const target = document.querySelector(%s);
+	if (!source || !target) return false;
+	const dataTransfer = new DataTransfer();
+	const fire = function(element, type) {
+		element.dispatchEvent(new DragEvent(type, { bubbles: true, cancelable: true, dataTransfer: dataTransfer }));
+	};
+	fire(source, 'dragstart');
+	fire(target, 'dragenter');
+	fire(target, 'dragover');
+	fire(target, 'drop');
+	fire(source, 'dragend');
+	return true;
+})()`, sourceJSON, targetJSON)
+
+	var ok bool
+	err := chromedp.Run(ctx,
+		chromedp.WaitVisible(source, chromedp.ByQuery),
+		chromedp.WaitReady(target, chromedp.ByQuery),
+		chromedp.Evaluate(script, &ok),
+		chromedp.Sleep(200*time.Millisecond),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to drag element %s to %s: %v", source, target, err)
+	}
+	if !ok {
+		return fmt.Errorf("failed to drag element %s to %s: element not found", source, target)
+	}
+	return nil
+}
+
+// executeUpload sets the files of a file input to the files attached to the
+// test case with the recorded names.
+func (te *TestExecutor) executeUpload(ctx context.Context, testCase *models.TestCase, step models.TestStep) error {
+	var names []string
+	if files, ok := step.Options["files"].([]interface{}); ok {
+		for _, file := range files {
+			if name, ok := file.(string); ok {
+				names = append(names, name)
+			}
+		}
+	} else if step.Value != "" {
+		names = strings.Split(step.Value, ", ")
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("upload step has no files")
+	}
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		file := findTestCaseFile(testCase.Files, name)
+		if file == nil {
+			return fmt.Errorf("file %s is not attached to the test case", name)
+		}
+		path, err := filepath.Abs(file.FilePath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve file %s: %v", name, err)
+		}
+		paths = append(paths, path)
+	}
+
+	err := chromedp.Run(ctx,
+		chromedp.WaitReady(step.Selector, chromedp.ByQuery),
+		chromedp.SetUploadFiles(step.Selector, paths, chromedp.ByQuery),
+		chromedp.Sleep(200*time.Millisecond),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upload files to %s: %v", step.Selector, err)
+	}
+	return nil
+}
+
+func findTestCaseFile(files []models.TestCaseFile, name string) *models.TestCaseFile {
+	for i := range files {
+		if files[i].FileName == name {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+func hasUploadStep(steps []models.TestStep) bool {
+	for _, step := range steps {
+		if step.Type == "upload" {
+			return true
+		}
+	}
+	return false
+}
+
+// elementCenter scrolls the element into view and returns the viewport
+// coordinates of its center for mouse input.
+func elementCenter(ctx context.Context, selector string) (float64, float64, error) {
+	var box *dom.BoxModel
+	err := chromedp.Run(ctx,
+		chromedp.WaitVisible(selector, chromedp.ByQuery),
+		chromedp.ScrollIntoView(selector, chromedp.ByQuery),
+		chromedp.Dimensions(selector, &box, chromedp.ByQuery),
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to locate element %s: %v", selector, err)
+	}
+	if box == nil || len(box.Content) < 8 {
+		return 0, 0, fmt.Errorf("element %s has no layout", selector)
+	}
+
+	// Content is a quad of four x,y points
+	var x, y float64
+	for i := 0; i < 8; i += 2 {
+		x += box.Content[i]
+		y += box.Content[i+1]
+	}
+	return x / 4, y / 4, nil
+}
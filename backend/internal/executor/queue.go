@@ -0,0 +1,387 @@
+package executor
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The test_executions table is the queue: a pending execution with QueuedAt
+// set is claimed by the first free worker, highest priority first and in
+// queue order within a priority. A claimed execution holds a lease that its
+// worker renews while it runs.
+
+// Idle workers look for work this often in case they missed a wake-up, for
+// example for executions queued by another process.
+const queuePollInterval = 5 * time.Second
+
+// A stale execution is run again at most this many times in total before it
+// is marked interrupted.
+const maxClaims = 2
+
+const queueOrder = "priority DESC, queued_at ASC, id ASC"
+
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// Enqueue makes a pending execution available to the workers and returns the
+// channel its result is sent on once it has finished, was cancelled or was
+// interrupted. It never blocks, executions wait in the queue while every
+// worker is busy.
+func (te *TestExecutor) Enqueue(execution *models.TestExecution) <-chan ExecutionResult {
+	resultChan := te.Wait(execution.ID)
+
+	now := time.Now()
+	queued := database.DB.Model(&models.TestExecution{}).
+		Where("id = ? AND status = ?", execution.ID, "pending").
+		Update("queued_at", &now).RowsAffected > 0
+	if !queued {
+		te.notify(execution.ID, ExecutionResult{Cancelled: true, ErrorMessage: "Execution cancelled"})
+		return resultChan
+	}
+	execution.QueuedAt = &now
+
+	select {
+	case te.wake <- struct{}{}:
+	default:
+	}
+	return resultChan
+}
+
+// Wait returns the channel the result of an already queued or running
+// execution is sent on.
+func (te *TestExecutor) Wait(executionID uint) <-chan ExecutionResult {
+	te.mutex.Lock()
+	defer te.mutex.Unlock()
+
+	resultChan, ok := te.waiters[executionID]
+	if !ok {
+		resultChan = make(chan ExecutionResult, 1)
+		te.waiters[executionID] = resultChan
+	}
+	return resultChan
+}
+
+// notify hands the final result of an execution to its waiter, if any.
+func (te *TestExecutor) notify(executionID uint, result ExecutionResult) bool {
+	result.ExecutionID = executionID
+
+	te.mutex.Lock()
+	resultChan, ok := te.waiters[executionID]
+	delete(te.waiters, executionID)
+	te.mutex.Unlock()
+
+	if ok {
+		resultChan <- result
+	}
+	return ok
+}
+
+// LeaseTimeout returns how long a lease lasts without being renewed.
+func (te *TestExecutor) LeaseTimeout() time.Duration {
+	return te.leaseTimeout
+}
+
+// Claim leases the next queued execution to owner and loads the test case to
+// run. Only test cases emulating one of deviceIDs are considered, unless
+// deviceIDs is empty. It returns nil if there is nothing to run.
+func (te *TestExecutor) Claim(owner string, deviceIDs []uint) *models.TestExecution {
+	for {
+		query := database.DB.Where("status = ? AND queued_at IS NOT NULL", "pending")
+		if len(deviceIDs) > 0 {
+			query = query.Where("test_case_id IN (?)",
+				database.DB.Model(&models.TestCase{}).Select("id").Where("device_id IN ?", deviceIDs))
+		}
+
+		var next models.TestExecution
+		if err := query.Order(queueOrder).First(&next).Error; err != nil {
+			return nil
+		}
+
+		// Another worker may have claimed or cancelled it in the meantime
+		now := time.Now()
+		claimed := database.DB.Model(&models.TestExecution{}).
+			Where("id = ? AND status = ?", next.ID, "pending").
+			Updates(map[string]interface{}{
+				"status":           "running",
+				"start_time":       now,
+				"lease_owner":      owner,
+				"lease_expires_at": now.Add(te.leaseTimeout),
+				"heartbeat_at":     now,
+				"claim_count":      gorm.Expr("claim_count + 1"),
+			}).RowsAffected > 0
+		if !claimed {
+			continue
+		}
+
+		var execution models.TestExecution
+		err := database.DB.Preload("TestCase").Preload("TestCase.Environment").
+			Preload("TestCase.Device").Preload("TestCase.Files").
+			First(&execution, next.ID).Error
+		if err != nil {
+			log.Printf("Failed to load claimed execution %d: %v", next.ID, err)
+			continue
+		}
+
+		// Record what ran, flakiness is judged per test case revision and environment
+		execution.EnvironmentID = execution.TestCase.EnvironmentID
+		execution.CaseRevision = execution.TestCase.Revision()
+		execution.Quarantined = execution.TestCase.Quarantined
+		database.DB.Model(&models.TestExecution{}).Where("id = ?", execution.ID).
+			Updates(map[string]interface{}{
+				"environment_id": execution.EnvironmentID,
+				"case_revision":  execution.CaseRevision,
+				"quarantined":    execution.Quarantined,
+			})
+		return &execution
+	}
+}
+
+// keepLease renews the lease of a running execution until ctx is done. The
+// execution is stopped when it was cancelled or taken over in the meantime.
+func (te *TestExecutor) keepLease(ctx context.Context, executionID uint, cancel context.CancelFunc) {
+	ticker := time.NewTicker(te.leaseTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !te.RenewLease(executionID, te.instanceID) {
+				log.Printf("Execution %d is no longer leased to this executor, stopping it", executionID)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// RenewLease extends the lease owner holds on a running execution. It returns
+// false once the execution was cancelled or taken over, the owner should then
+// stop running it.
+func (te *TestExecutor) RenewLease(executionID uint, owner string) bool {
+	now := time.Now()
+	result := database.DB.Model(&models.TestExecution{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", executionID, "running", owner).
+		Updates(map[string]interface{}{"heartbeat_at": now, "lease_expires_at": now.Add(te.leaseTimeout)})
+	return result.Error != nil || result.RowsAffected > 0
+}
+
+// AppendLogs adds log entries of an execution still running under owner's
+// lease, so they can be followed before the result arrives.
+func (te *TestExecutor) AppendLogs(executionID uint, owner string, logs []ExecutionLog) bool {
+	var execution models.TestExecution
+	err := database.DB.Select("id", "execution_logs").
+		Where("id = ? AND status = ? AND lease_owner = ?", executionID, "running", owner).
+		First(&execution).Error
+	if err != nil {
+		return false
+	}
+
+	var existing []ExecutionLog
+	json.Unmarshal([]byte(execution.ExecutionLogs), &existing)
+	logsJSON, err := json.Marshal(append(existing, logs...))
+	if err != nil {
+		return false
+	}
+
+	return database.DB.Model(&execution).Update("execution_logs", string(logsJSON)).Error == nil
+}
+
+// Complete saves the result owner reports for an execution it leased and
+// hands it to whoever waits for it. It returns false if the lease was lost.
+func (te *TestExecutor) Complete(execution *models.TestExecution, owner string, result ExecutionResult) bool {
+	if !saveResult(execution, owner, result) {
+		return false
+	}
+
+	// Whoever waits for this attempt waits for the retry instead
+	if retry := scheduleRetry(execution.ID, result); retry != nil {
+		te.mutex.Lock()
+		if resultChan, ok := te.waiters[execution.ID]; ok {
+			delete(te.waiters, execution.ID)
+			te.waiters[retry.ID] = resultChan
+		}
+		te.mutex.Unlock()
+
+		select {
+		case te.wake <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	te.notify(execution.ID, result)
+	if te.onFinish != nil && !result.Cancelled {
+		go te.onFinish(execution.TestCaseID)
+	}
+	return true
+}
+
+// saveResult stores the outcome of a finished execution along with its logs,
+// screenshots and performance metrics. Nothing is saved if the execution was
+// taken over after its lease expired.
+func saveResult(execution *models.TestExecution, owner string, result ExecutionResult) bool {
+	status := "failed"
+	errorMessage := result.ErrorMessage
+	errorClass := ""
+	if result.Cancelled {
+		status = "cancelled"
+	} else if result.Success {
+		status = "passed"
+		errorMessage = ""
+	} else {
+		errorClass = ClassifyError(errorMessage)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":           status,
+		"error_message":    errorMessage,
+		"error_class":      errorClass,
+		"end_time":         &now,
+		"duration":         int(now.Sub(execution.StartTime).Seconds()),
+		"lease_expires_at": nil,
+	}
+
+	// Save logs and screenshots
+	if logsJSON, err := json.Marshal(result.Logs); err == nil {
+		updates["execution_logs"] = string(logsJSON)
+	}
+	if screenshotsJSON, err := json.Marshal(result.Screenshots); err == nil {
+		updates["screenshots"] = string(screenshotsJSON)
+	}
+
+	saved := database.DB.Model(&models.TestExecution{}).
+		Where("id = ? AND lease_owner = ? AND status = ?", execution.ID, owner, "running").
+		Updates(updates).RowsAffected > 0
+	if !saved {
+		// Cancelled while it ran, the outcome is kept for the record
+		updates["status"] = "cancelled"
+		saved = database.DB.Model(&models.TestExecution{}).
+			Where("id = ? AND lease_owner = ? AND status = ?", execution.ID, owner, "cancelled").
+			Updates(updates).RowsAffected > 0
+	}
+	if !saved {
+		log.Printf("Discarding result of execution %d, it is no longer leased to %s", execution.ID, owner)
+		return false
+	}
+
+	// Save performance metrics if available
+	if result.Metrics != nil {
+		result.Metrics.ExecutionID = execution.ID
+		database.DB.Create(result.Metrics)
+	}
+	return true
+}
+
+// QueuePosition returns the 1-based position of a queued execution, or 0 if
+// the execution is not waiting for a worker.
+func (te *TestExecutor) QueuePosition(executionID uint) int {
+	var execution models.TestExecution
+	err := database.DB.Select("id", "status", "priority", "queued_at").First(&execution, executionID).Error
+	if err != nil || execution.Status != "pending" || execution.QueuedAt == nil {
+		return 0
+	}
+
+	var ahead int64
+	database.DB.Model(&models.TestExecution{}).
+		Where("status = ? AND queued_at IS NOT NULL", "pending").
+		Where("priority > ? OR (priority = ? AND (queued_at < ? OR (queued_at = ? AND id < ?)))",
+			execution.Priority, execution.Priority, execution.QueuedAt, execution.QueuedAt, execution.ID).
+		Count(&ahead)
+	return int(ahead) + 1
+}
+
+// GetQueuedCount returns the number of executions waiting for a worker.
+func (te *TestExecutor) GetQueuedCount() int {
+	var count int64
+	database.DB.Model(&models.TestExecution{}).
+		Where("status = ? AND queued_at IS NOT NULL", "pending").Count(&count)
+	return int(count)
+}
+
+// reapStale periodically recovers executions whose worker stopped renewing
+// the lease.
+func (te *TestExecutor) reapStale() {
+	ticker := time.NewTicker(te.leaseTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-te.stop:
+			return
+		case <-ticker.C:
+			te.recoverStale(false)
+		}
+	}
+}
+
+// recoverStale puts running executions with an expired lease back into the
+// queue, or marks them interrupted if requeueing is disabled or they already
+// were run again. At startup, executions leased by an earlier process on this
+// host are stale too, since that process is gone.
+func (te *TestExecutor) recoverStale(startup bool) {
+	hostname, _ := os.Hostname()
+
+	query := database.DB.Where("status = ?", "running")
+	if startup {
+		query = query.Where("lease_expires_at IS NULL OR lease_expires_at < ? OR lease_owner LIKE ?",
+			time.Now(), hostname+":%")
+	} else {
+		query = query.Where("lease_expires_at IS NULL OR lease_expires_at < ?", time.Now())
+	}
+
+	var stale []models.TestExecution
+	query.Find(&stale)
+
+	for _, execution := range stale {
+		stillStale := database.DB.Model(&models.TestExecution{}).
+			Where("id = ? AND status = ? AND lease_owner = ?", execution.ID, "running", execution.LeaseOwner)
+
+		if te.requeueStale && execution.ClaimCount < maxClaims {
+			queuedAt := execution.QueuedAt
+			if queuedAt == nil {
+				now := time.Now()
+				queuedAt = &now
+			}
+			requeued := stillStale.Updates(map[string]interface{}{
+				"status":           "pending",
+				"queued_at":        queuedAt,
+				"lease_owner":      "",
+				"lease_expires_at": nil,
+			}).RowsAffected > 0
+			if requeued {
+				log.Printf("Requeued stale execution %d (lease owner %q)", execution.ID, execution.LeaseOwner)
+			}
+			continue
+		}
+
+		now := time.Now()
+		message := "Execution interrupted: the executor running it stopped responding"
+		interrupted := stillStale.Updates(map[string]interface{}{
+			"status":           "interrupted",
+			"error_message":    message,
+			"end_time":         &now,
+			"duration":         int(now.Sub(execution.StartTime).Seconds()),
+			"lease_expires_at": nil,
+		}).RowsAffected > 0
+		if interrupted {
+			log.Printf("Marked stale execution %d interrupted (lease owner %q)", execution.ID, execution.LeaseOwner)
+			te.notify(execution.ID, ExecutionResult{ErrorMessage: message})
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Error classes a failed execution is sorted into. Retry policies name the
+// classes worth retrying.
+const (
+	ErrorClassTimeout    = "timeout"
+	ErrorClassNavigation = "navigation"
+	ErrorClassElement    = "element"
+	ErrorClassAssertion  = "assertion"
+	ErrorClassBrowser    = "browser"
+	ErrorClassOther      = "other"
+)
+
+var errorClasses = map[string]bool{
+	ErrorClassTimeout:    true,
+	ErrorClassNavigation: true,
+	ErrorClassElement:    true,
+	ErrorClassAssertion:  true,
+	ErrorClassBrowser:    true,
+	ErrorClassOther:      true,
+}
+
+// ClassifyError sorts the error message of a failed execution into an error
+// class.
+func ClassifyError(message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "deadline exceeded") || strings.Contains(lower, "timeout") ||
+		strings.Contains(lower, "timed out"):
+		return ErrorClassTimeout
+	case strings.Contains(lower, "failed to navigate") || strings.Contains(lower, "net::err_"):
+		return ErrorClassNavigation
+	case strings.Contains(lower, "assertion failed"):
+		return ErrorClassAssertion
+	case strings.Contains(lower, "chrome") || strings.Contains(lower, "target closed") ||
+		strings.Contains(lower, "websocket"):
+		return ErrorClassBrowser
+	case strings.Contains(lower, "element") || strings.Contains(lower, "could not find node") ||
+		strings.Contains(lower, "selector"):
+		return ErrorClassElement
+	}
+	return ErrorClassOther
+}
+
+// ValidateRetryOn checks a comma separated list of error classes.
+func ValidateRetryOn(retryOn string) error {
+	for _, class := range splitRetryOn(retryOn) {
+		if !errorClasses[class] {
+			return fmt.Errorf("unknown error class %q", class)
+		}
+	}
+	return nil
+}
+
+func splitRetryOn(retryOn string) []string {
+	var classes []string
+	for _, class := range strings.Split(retryOn, ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// shouldRetry reports whether an attempt that failed with errorClass is run
+// again. A test case with its own retry policy overrides the suite's.
+func shouldRetry(execution *models.TestExecution, testCase *models.TestCase, testSuite *models.TestSuite, errorClass string) bool {
+	maxAttempts, retryOn := 1, ""
+	if testCase.RetryMaxAttempts > 0 {
+		maxAttempts, retryOn = testCase.RetryMaxAttempts, testCase.RetryOn
+	} else if testSuite != nil {
+		maxAttempts, retryOn = testSuite.RetryMaxAttempts, testSuite.RetryOn
+	}
+
+	if execution.Attempt >= maxAttempts {
+		return false
+	}
+
+	classes := splitRetryOn(retryOn)
+	if len(classes) == 0 {
+		return true
+	}
+	for _, class := range classes {
+		if class == errorClass {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleRetry queues another attempt of a failed execution if its retry
+// policy asks for one. The failed attempt is kept, marked retried, and linked
+// from the new one.
+func scheduleRetry(executionID uint, result ExecutionResult) *models.TestExecution {
+	if result.Success || result.Cancelled {
+		return nil
+	}
+
+	var execution models.TestExecution
+	if err := database.DB.Preload("TestCase").First(&execution, executionID).Error; err != nil {
+		return nil
+	}
+
+	var testSuite *models.TestSuite
+	if execution.TestSuiteID != nil {
+		testSuite = &models.TestSuite{}
+		if err := database.DB.First(testSuite, *execution.TestSuiteID).Error; err != nil {
+			testSuite = nil
+		}
+	}
+
+	if !shouldRetry(&execution, &execution.TestCase, testSuite, execution.ErrorClass) {
+		return nil
+	}
+
+	now := time.Now()
+	retry := models.TestExecution{
+		TestCaseID:    execution.TestCaseID,
+		TestSuiteID:   execution.TestSuiteID,
+		SuiteRunID:    execution.SuiteRunID,
+		ExecutionType: execution.ExecutionType,
+		Status:        "pending",
+		Priority:      execution.Priority,
+		IsVisual:      execution.IsVisual,
+		QueuedAt:      &now,
+		StartTime:     now,
+		Attempt:       execution.Attempt + 1,
+		RetryOfID:     &execution.ID,
+		UserID:        execution.UserID,
+		ErrorMessage:  "",
+		ExecutionLogs: "[]",
+		Screenshots:   "[]",
+	}
+	if err := database.DB.Create(&retry).Error; err != nil {
+		log.Printf("Failed to create retry of execution %d: %v", execution.ID, err)
+		return nil
+	}
+	database.DB.Model(&execution).Update("retried", true)
+
+	log.Printf("Retrying execution %d as %d (attempt %d, %s error)", execution.ID, retry.ID, retry.Attempt, execution.ErrorClass)
+	return &retry
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"autoui-platform/backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// applyStartState restores the cookies and localStorage captured when the
+// test case was recorded. It must run before the first navigation. The
+// captured viewport is only restored with restoreViewport, for test cases
+// without a device whose emulation takes precedence.
+func applyStartState(ctx context.Context, state *models.StartState, restoreViewport bool) error {
+	actions := []chromedp.Action{}
+
+	if restoreViewport {
+		if state.Viewport.Width > 0 && state.Viewport.Height > 0 {
+			actions = append(actions, chromedp.EmulateViewport(int64(state.Viewport.Width), int64(state.Viewport.Height)))
+		}
+		if state.Viewport.UserAgent != "" {
+			actions = append(actions, emulation.SetUserAgentOverride(state.Viewport.UserAgent))
+		}
+	}
+
+	if len(state.Cookies) > 0 {
+		cookies := make([]*network.CookieParam, 0, len(state.Cookies))
+		for _, c := range state.Cookies {
+			cookie := &network.CookieParam{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				HTTPOnly: c.HTTPOnly,
+				Secure:   c.Secure,
+			}
+			if c.Expires > 0 {
+				expires := cdp.TimeSinceEpoch(time.Unix(0, int64(c.Expires*float64(time.Second))))
+				cookie.Expires = &expires
+			}
+			if c.SameSite != "" {
+				cookie.SameSite = network.CookieSameSite(c.SameSite)
+			}
+			cookies = append(cookies, cookie)
+		}
+		actions = append(actions, network.SetCookies(cookies))
+	}
+
+	if len(state.LocalStorage) > 0 {
+		items, err := json.Marshal(state.LocalStorage)
+		if err != nil {
+			return fmt.Errorf("failed to encode localStorage: %w", err)
+		}
+		origin, err := json.Marshal(state.StorageOrigin)
+		if err != nil {
+			return fmt.Errorf("failed to encode localStorage origin: %w", err)
+		}
+		// Only seed storage on the first load of the tab in the origin it was
+		// captured from, so that redirects through other hosts don't receive
+		// it and the test can change or clear it afterwards. State captured
+		// without an origin is seeded into the first document.
+		script := fmt.Sprintf(`(function() {
+	var origin = %s;
+	if (window.top !== window || (origin && window.location.origin !== origin)) return;
+	if (sessionStorage.getItem('__autoui_state_applied')) return;
+	sessionStorage.setItem('__autoui_state_applied', '1');
+	var items = %s;
+	Object.keys(items).forEach(function(key) { localStorage.setItem(key, items[key]); });
+})();`, origin, items)
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
+			return err
+		}))
+	}
+
+	return chromedp.Run(ctx, actions...)
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"gorm.io/gorm"
 )
@@ -77,9 +79,44 @@ type TestCase struct {
 	ExpectedResult  string    `json:"expected_result" gorm:"size:1000"`
 	Tags            string    `json:"tags" gorm:"size:500"`
 	Priority        int       `json:"priority" gorm:"default:1"` // 1:low, 2:medium, 3:high
+	StartState      string    `json:"start_state" gorm:"type:longtext"` // JSON format StartState captured when recording
+	RetryMaxAttempts int      `json:"retry_max_attempts" gorm:"default:0"` // attempts including the first, 0 to use the suite's retry policy
+	RetryOn         string    `json:"retry_on" gorm:"size:200"` // comma separated error classes to retry, empty for any failure
+	FlakinessScore  float64   `json:"flakiness_score"`                    // share of recent runs that flipped or passed only on retry, 0 to 1
+	IsFlaky         bool      `json:"is_flaky" gorm:"default:false;index"` // flakiness score reached the threshold
+	Quarantined     bool      `json:"quarantined" gorm:"default:false"`   // still runs, but failures don't fail suites or reports
+	QuarantinedAt   *time.Time `json:"quarantined_at"`
 	Status          int       `json:"status" gorm:"default:1"`   // 1:active, 0:inactive
 	UserID          uint      `json:"user_id" gorm:"not null"`
 	User            User      `json:"user" gorm:"foreignKey:UserID"`
+	Files           []TestCaseFile `json:"files,omitempty" gorm:"foreignKey:TestCaseID"` // Files available to upload steps
+}
+
+// StartState is the browser state a recording started from, restored before
+// replaying the first step.
+type StartState struct {
+	Viewport     StartViewport     `json:"viewport"`
+	Cookies      []StartCookie     `json:"cookies"`
+	LocalStorage map[string]string `json:"local_storage"`
+	// StorageOrigin is the origin LocalStorage was captured from
+	StorageOrigin string `json:"storage_origin,omitempty"`
+}
+
+type StartViewport struct {
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	UserAgent string `json:"user_agent"`
+}
+
+type StartCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires"` // seconds since epoch, <= 0 for session cookies
+	HTTPOnly bool    `json:"http_only"`
+	Secure   bool    `json:"secure"`
+	SameSite string  `json:"same_site"`
 }
 
 func (tc *TestCase) GetSteps() ([]TestStep, error) {
@@ -100,6 +137,26 @@ func (tc *TestCase) SetSteps(steps []TestStep) error {
 	return nil
 }
 
+// GetStartState returns nil if the test case has no recorded start state.
+func (tc *TestCase) GetStartState() (*StartState, error) {
+	if tc.StartState == "" {
+		return nil, nil
+	}
+	var state StartState
+	err := json.Unmarshal([]byte(tc.StartState), &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Revision identifies what the test case does. It changes whenever the
+// steps, target URL or start state are edited.
+func (tc *TestCase) Revision() string {
+	hash := sha256.Sum256([]byte(tc.TargetURL + "\x00" + tc.Steps + "\x00" + tc.StartState))
+	return hex.EncodeToString(hash[:8])
+}
+
 type TestSuite struct {
 	BaseModel
 	Name            string      `json:"name" gorm:"size:200;not null"`
@@ -110,28 +167,84 @@ type TestSuite struct {
 	Environment     Environment `json:"environment" gorm:"foreignKey:EnvironmentID"`
 	TestCases       []TestCase  `json:"test_cases" gorm:"many2many:test_suite_cases;"`
 	TestCaseCount   int         `json:"test_case_count" gorm:"-"` // Virtual field for count
-	Schedule        string      `json:"schedule" gorm:"size:100"` // Cron expression (old field)
+	Schedule        string      `json:"schedule" gorm:"size:100"` // Deprecated: migrated into CronExpression on startup
 	CronExpression  string      `json:"cron_expression" gorm:"size:100"` // New cron field
+	SchedulePaused  bool        `json:"schedule_paused" gorm:"default:false"` // Keeps the expression but stops firing
+	ScheduleTimezone string     `json:"schedule_timezone" gorm:"size:64"` // IANA name the expression is evaluated in, empty for server time
+	OverlapPolicy   string      `json:"overlap_policy" gorm:"size:20;default:skip"` // skip, queue_one, cancel_previous: what a schedule does while the suite is running
+	RunState        string      `json:"run_state" gorm:"size:20;default:idle"` // idle, running
+	RunStartedAt    *time.Time  `json:"run_started_at"`
+	QueuedRunAt     *time.Time  `json:"queued_run_at"` // fire time of a scheduled run waiting for the current one (queue_one)
+	LastFiredAt     *time.Time  `json:"last_fired_at"` // last time the schedule fired, used to detect runs missed during downtime
+	MissedRunPolicy string      `json:"missed_run_policy" gorm:"size:20;default:skip"` // skip, run_once: what to do about runs missed during downtime
 	IsParallel      bool        `json:"is_parallel" gorm:"default:false"`
 	TimeoutMinutes  int         `json:"timeout_minutes" gorm:"default:60"`
 	Tags            string      `json:"tags" gorm:"size:500"`
 	Priority        int         `json:"priority" gorm:"default:2"` // 1:low, 2:medium, 3:high
+	RetryMaxAttempts int        `json:"retry_max_attempts" gorm:"default:1"` // attempts per test case including the first
+	RetryOn         string      `json:"retry_on" gorm:"size:200"` // comma separated error classes to retry, empty for any failure
 	Status          int         `json:"status" gorm:"default:1"`
 	UserID          uint        `json:"user_id" gorm:"not null"`
 	User            User        `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// ScheduleRun records what happened when the schedule of a test suite fired.
+type ScheduleRun struct {
+	BaseModel
+	TestSuiteID    uint      `json:"test_suite_id" gorm:"not null;index"`
+	FiredAt        time.Time `json:"fired_at"`
+	Status         string    `json:"status" gorm:"size:20;not null"` // started, queued, skipped, missed, failed
+	Reason         string    `json:"reason" gorm:"size:500"`
+	ExecutionCount int       `json:"execution_count"`
+}
+
+// ScheduleBlackout is a period in which scheduled suite runs are skipped,
+// either recurring every week or on specific dates.
+type ScheduleBlackout struct {
+	BaseModel
+	Name      string  `json:"name" gorm:"size:200;not null"`
+	ProjectID *uint   `json:"project_id"` // nil applies to all projects
+	Project   Project `json:"project" gorm:"foreignKey:ProjectID"`
+	Type      string  `json:"type" gorm:"size:20;not null"` // weekly, dates
+	StartDay  int     `json:"start_day"`                    // weekly: 0=Sunday ... 6=Saturday
+	StartTime string  `json:"start_time" gorm:"size:5"`     // weekly: HH:MM
+	EndDay    int     `json:"end_day"`
+	EndTime   string  `json:"end_time" gorm:"size:5"`
+	StartDate string  `json:"start_date" gorm:"size:10"` // dates: YYYY-MM-DD, inclusive
+	EndDate   string  `json:"end_date" gorm:"size:10"`
+	Timezone  string  `json:"timezone" gorm:"size:64"` // empty for server time
+	Status    int     `json:"status" gorm:"default:1"`
+	UserID    uint    `json:"user_id" gorm:"not null"`
+	User      User    `json:"user" gorm:"foreignKey:UserID"`
+}
+
 type TestExecution struct {
 	BaseModel
 	TestCaseID     uint       `json:"test_case_id"`
 	TestCase       TestCase   `json:"test_case" gorm:"foreignKey:TestCaseID"`
 	TestSuiteID    *uint      `json:"test_suite_id"` // nullable for single test execution
 	TestSuite      TestSuite  `json:"test_suite" gorm:"foreignKey:TestSuiteID"`
+	SuiteRunID     *uint      `json:"suite_run_id" gorm:"index"` // the suite run the execution is part of
 	ExecutionType  string     `json:"execution_type"` // test_case, test_suite
-	Status         string     `json:"status"`         // pending, running, success, failed, cancelled
+	Status         string     `json:"status"`         // pending, running, success, failed, cancelled, interrupted
+	Priority       int        `json:"priority" gorm:"default:2;index"` // suite priority, then test case priority; higher runs first
+	QueuePosition  int        `json:"queue_position" gorm:"-"`         // 1-based position while waiting for a worker
+	IsVisual       bool       `json:"is_visual"`
+	QueuedAt       *time.Time `json:"queued_at" gorm:"index"`        // set once the execution may be claimed by a worker
+	LeaseOwner     string     `json:"lease_owner" gorm:"size:200"`   // worker holding the running execution
+	LeaseExpiresAt *time.Time `json:"lease_expires_at"`              // the execution is stale once this passes without a heartbeat
+	HeartbeatAt    *time.Time `json:"heartbeat_at"`
+	ClaimCount     int        `json:"claim_count"` // times a worker started the execution
+	Attempt        int        `json:"attempt" gorm:"default:1"`     // 1 for the first run, higher for retries
+	RetryOfID      *uint      `json:"retry_of_id" gorm:"index"`     // the failed attempt this one retries
+	Retried        bool       `json:"retried" gorm:"default:false"` // a later attempt supersedes this one
+	ErrorClass     string     `json:"error_class" gorm:"size:50"`   // timeout, navigation, element, assertion, browser, other
+	EnvironmentID  uint       `json:"environment_id"`                 // environment the test case ran against
+	CaseRevision   string     `json:"case_revision" gorm:"size:64"`   // revision of the test case that ran, see TestCase.Revision
+	Quarantined    bool       `json:"quarantined" gorm:"default:false"` // the test case was quarantined when it ran
 	StartTime      time.Time  `json:"start_time"`
 	EndTime        *time.Time `json:"end_time"`
-	Duration       int        `json:"duration"`       // in milliseconds
+	Duration       int        `json:"duration"`       // in seconds
 	TotalCount     int        `json:"total_count"`    // Total test steps/cases
 	PassedCount    int        `json:"passed_count"`   // Passed test steps/cases
 	FailedCount    int        `json:"failed_count"`   // Failed test steps/cases
@@ -142,6 +255,40 @@ type TestExecution struct {
 	User           User       `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// CountsAsFailure reports whether the execution fails its suite or report.
+// Failures of quarantined test cases don't.
+func (e *TestExecution) CountsAsFailure() bool {
+	return e.Status == "failed" && !e.Quarantined
+}
+
+// SuiteRun is one run of a test suite, grouping the executions of its test
+// cases. Retries of a test case belong to the same run.
+type SuiteRun struct {
+	BaseModel
+	TestSuiteID        uint            `json:"test_suite_id" gorm:"not null;index"`
+	TestSuite          TestSuite       `json:"test_suite" gorm:"foreignKey:TestSuiteID"`
+	ProjectID          uint            `json:"project_id" gorm:"index"`
+	EnvironmentID      uint            `json:"environment_id"`
+	Environment        Environment     `json:"environment" gorm:"foreignKey:EnvironmentID"`
+	Trigger            string          `json:"trigger" gorm:"size:20"`              // manual, schedule, api, rerun
+	Status             string          `json:"status" gorm:"size:20;index"`         // running, passed, failed, cancelled
+	RerunOfID          *uint           `json:"rerun_of_id"`                         // the run whose failed test cases this run repeats
+	IsVisual           bool            `json:"is_visual"`
+	TotalCases         int             `json:"total_cases"`
+	PassedCases        int             `json:"passed_cases"`
+	FailedCases        int             `json:"failed_cases"`
+	ErrorCases         int             `json:"error_cases"` // interrupted
+	CancelledCases     int             `json:"cancelled_cases"`
+	PassedOnRetryCases int             `json:"passed_on_retry_cases"`
+	QuarantinedCases   int             `json:"quarantined_cases"`
+	StartTime          time.Time       `json:"start_time"`
+	EndTime            *time.Time      `json:"end_time"`
+	Duration           int             `json:"duration"` // in seconds
+	UserID             uint            `json:"user_id" gorm:"not null"`
+	User               User            `json:"user" gorm:"foreignKey:UserID"`
+	Executions         []TestExecution `json:"executions,omitempty" gorm:"foreignKey:SuiteRunID"`
+}
+
 type TestReport struct {
 	BaseModel
 	Name          string         `json:"name" gorm:"size:200;not null"`
@@ -149,11 +296,14 @@ type TestReport struct {
 	Project       Project        `json:"project" gorm:"foreignKey:ProjectID"`
 	TestSuiteID   *uint          `json:"test_suite_id"`
 	TestSuite     TestSuite      `json:"test_suite" gorm:"foreignKey:TestSuiteID"`
+	SuiteRunID    *uint          `json:"suite_run_id" gorm:"index"` // set for reports created when a suite run completed
 	Executions    []TestExecution `json:"executions" gorm:"many2many:test_report_executions;"`
 	TotalCases    int            `json:"total_cases"`
 	PassedCases   int            `json:"passed_cases"`
 	FailedCases   int            `json:"failed_cases"`
 	ErrorCases    int            `json:"error_cases"`
+	PassedOnRetryCases int       `json:"passed_on_retry_cases"` // passed only after failed attempts, included in PassedCases
+	QuarantinedCases int         `json:"quarantined_cases"`     // failed while quarantined, not included in FailedCases
 	StartTime     time.Time      `json:"start_time"`
 	EndTime       time.Time      `json:"end_time"`
 	Duration      int            `json:"duration"` // in seconds
@@ -176,6 +326,17 @@ type PerformanceMetric struct {
 	JSHeapSize        float64 `json:"js_heap_size"`        // MB
 }
 
+// TestCaseFile is a file attached to a test case. Upload steps refer to
+// attached files by name.
+type TestCaseFile struct {
+	BaseModel
+	TestCaseID uint   `json:"test_case_id" gorm:"not null;index"`
+	FileName   string `json:"file_name" gorm:"size:255;not null"`
+	FilePath   string `json:"-" gorm:"size:500;not null"`
+	FileSize   int64  `json:"file_size"`
+	UserID     uint   `json:"user_id" gorm:"not null"`
+}
+
 type Screenshot struct {
 	BaseModel
 	ExecutionID uint          `json:"execution_id" gorm:"not null"`
@@ -185,4 +346,30 @@ type Screenshot struct {
 	FilePath    string        `json:"file_path" gorm:"size:500;not null"`
 	FileName    string        `json:"file_name" gorm:"size:255;not null"`
 	FileSize    int64         `json:"file_size"`
-}
\ No newline at end of file
+}
+
+// Agent is a separate machine that leases queued executions from the server
+// and runs them with its own browsers.
+type Agent struct {
+	BaseModel
+	Name       string     `json:"name" gorm:"size:100;uniqueIndex;not null"`
+	Hostname   string     `json:"hostname" gorm:"size:200"`
+	Version    string     `json:"version" gorm:"size:50"`
+	Capacity   int        `json:"capacity"`                    // executions it runs at the same time
+	DeviceIDs  string     `json:"device_ids" gorm:"type:text"` // JSON array of device IDs it runs, empty for all
+	Browsers   string     `json:"browsers" gorm:"type:text"`   // JSON array of available browsers
+	TokenHash  string     `json:"-" gorm:"size:64;index"`
+	Running    int        `json:"running"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	Status     int        `json:"status" gorm:"default:1"` // 1:enabled, 0:disabled
+}
+
+// GetDeviceIDs returns the devices the agent accepts executions for, empty
+// for all.
+func (a *Agent) GetDeviceIDs() []uint {
+	var deviceIDs []uint
+	if a.DeviceIDs != "" {
+		json.Unmarshal([]byte(a.DeviceIDs), &deviceIDs)
+	}
+	return deviceIDs
+}
@@ -5,24 +5,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/chrome"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
 	"github.com/gorilla/websocket"
-	"autoui-platform/backend/pkg/chrome"
+)
+
+const (
+	// eventBindingName is the function the recording script calls to hand
+	// each captured event to the server
+	eventBindingName = "autoUIRecorderEmit"
+
+	// The pointer has to rest on an element this long before a hover that
+	// changed the page is recorded
+	hoverDwellMillis = 500
+	// Pointer movement with the button held beyond this many pixels is a drag
+	dragThresholdPixels = 10
 )
 
 type ChromeRecorder struct {
-	ctx        context.Context
-	cancel     context.CancelFunc
-	isRecording bool
-	steps      []RecordStep
-	mutex      sync.RWMutex
-	wsConn     *websocket.Conn
-	deviceInfo DeviceInfo
-	sessionID  string
-	targetURL  string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	isRecording  bool
+	isPaused     bool
+	closed       bool   // the session was discarded, no more viewers attach
+	assertMode   string // assertion the next click records, empty for none
+	steps        []RecordStep
+	rawSteps     []RecordStep
+	mutex        sync.RWMutex
+	viewers      map[*websocket.Conn]*viewer
+	deviceInfo   DeviceInfo
+	sessionID    string
+	targetURL    string
+	options      StartOptions
+	startState   models.StartState
+	createdAt    time.Time
+	lastActivity time.Time
+
+	// stateMutex serializes updates of the page state script, stateScriptID
+	// is the one currently installed
+	stateMutex    sync.Mutex
+	stateScriptID page.ScriptIdentifier
+}
+
+// StartOptions controls how a recording session's browser is launched.
+type StartOptions struct {
+	// OwnerID is the user who started the session
+	OwnerID uint `json:"owner_id"`
+	// CaptureState snapshots cookies and localStorage once the start page
+	// has loaded, in addition to the URL and viewport
+	CaptureState bool `json:"capture_state"`
+	// Headless runs Chrome without a window on the server; the page is
+	// streamed to the client over the recording WebSocket instead
+	Headless bool `json:"headless"`
 }
 
 type DeviceInfo struct {
@@ -50,12 +92,17 @@ var Manager = &RecorderManager{
 	recorders: make(map[string]*ChromeRecorder),
 }
 
-func NewChromeRecorder(sessionID string, device DeviceInfo) *ChromeRecorder {
+func NewChromeRecorder(sessionID string, device DeviceInfo, options StartOptions) *ChromeRecorder {
 	return &ChromeRecorder{
-		isRecording: false,
-		steps:       make([]RecordStep, 0),
-		deviceInfo:  device,
-		sessionID:   sessionID,
+		isRecording:  false,
+		steps:        make([]RecordStep, 0),
+		rawSteps:     make([]RecordStep, 0),
+		viewers:      make(map[*websocket.Conn]*viewer),
+		deviceInfo:   device,
+		sessionID:    sessionID,
+		options:      options,
+		createdAt:    time.Now(),
+		lastActivity: time.Now(),
 	}
 }
 
@@ -76,7 +123,7 @@ func (r *ChromeRecorder) StartRecording(targetURL string) error {
 	// Create Chrome context with device emulation
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.ExecPath(chromePath),
-		chromedp.Flag("headless", false),
+		chromedp.Flag("headless", r.options.Headless),
 		chromedp.Flag("disable-web-security", true),
 		chromedp.Flag("disable-features", "VizDisplayCompositor"),
 		chromedp.Flag("disable-blink-features", "AutomationControlled"),
@@ -100,12 +147,29 @@ func (r *ChromeRecorder) StartRecording(targetURL string) error {
 	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
 	r.ctx, r.cancel = chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
 
-	// Navigate to target URL and inject recording script
+	r.steps = make([]RecordStep, 0)
+	r.rawSteps = make([]RecordStep, 0)
+
+	// The page pushes each event through a CDP binding as it happens, so
+	// nothing is lost when the page navigates away right after an action
+	events := newEventQueue()
+	chromedp.ListenTarget(r.ctx, func(ev interface{}) {
+		if called, ok := ev.(*runtime.EventBindingCalled); ok && called.Name == eventBindingName {
+			events.push(called.Payload)
+		}
+	})
+	go r.listenForEvents(events)
+
+	// Register the binding and the recording script for every document the
+	// tab loads, then navigate to the target URL
 	err := chromedp.Run(r.ctx,
+		runtime.AddBinding(eventBindingName),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := page.AddScriptToEvaluateOnNewDocument(getRecordingScript()).Do(ctx)
+			return err
+		}),
 		chromedp.Navigate(targetURL),
 		chromedp.WaitReady("body", chromedp.ByQuery),
-		chromedp.Sleep(3*time.Second), // Wait for dynamic content to load
-		chromedp.Evaluate(getRecordingScript(), nil),
 	)
 
 	if err != nil {
@@ -113,20 +177,35 @@ func (r *ChromeRecorder) StartRecording(targetURL string) error {
 		return fmt.Errorf("failed to start recording: %w", err)
 	}
 
-	r.isRecording = true
-	r.steps = make([]RecordStep, 0)
+	r.targetURL = targetURL
+	r.startState = models.StartState{Viewport: models.StartViewport{
+		Width:     r.deviceInfo.Width,
+		Height:    r.deviceInfo.Height,
+		UserAgent: r.deviceInfo.UserAgent,
+	}}
+	if r.options.CaptureState {
+		if err := captureStorage(r.ctx, &r.startState); err != nil {
+			// The recording itself still works, replays just start clean
+			log.Printf("Session %s: %v", r.sessionID, err)
+		}
+	}
 
-	// Start listening for events
-	go r.listenForEvents()
+	if r.options.Headless {
+		if err := r.startScreencast(); err != nil {
+			cancel()
+			return fmt.Errorf("failed to start screencast: %w", err)
+		}
+	}
+
+	r.isRecording = true
 
 	return nil
 }
 
 func (r *ChromeRecorder) StopRecording() error {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
-
 	if !r.isRecording {
+		r.mutex.Unlock()
 		return fmt.Errorf("no recording in progress")
 	}
 
@@ -135,6 +214,10 @@ func (r *ChromeRecorder) StopRecording() error {
 	}
 
 	r.isRecording = false
+	r.isPaused = false
+	r.mutex.Unlock()
+
+	r.notifyStatus()
 	return nil
 }
 
@@ -145,6 +228,15 @@ func (r *ChromeRecorder) GetSteps() []RecordStep {
 	return append([]RecordStep(nil), r.steps...)
 }
 
+// GetRawSteps returns every event exactly as reported by the page, before
+// coalescing. It is kept for debugging the recorder.
+func (r *ChromeRecorder) GetRawSteps() []RecordStep {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]RecordStep(nil), r.rawSteps...)
+}
+
 func (r *ChromeRecorder) IsRecording() bool {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -152,53 +244,245 @@ func (r *ChromeRecorder) IsRecording() bool {
 	return r.isRecording
 }
 
-func (r *ChromeRecorder) listenForEvents() {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+func (r *ChromeRecorder) IsHeadless() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.options.Headless
+}
+
+func (r *ChromeRecorder) IsPaused() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.isPaused
+}
+
+// PauseRecording stops capturing events in the page until ResumeRecording is
+// called, e.g. while the tester types credentials or explores the page.
+func (r *ChromeRecorder) PauseRecording() error {
+	return r.setPaused(true)
+}
 
+func (r *ChromeRecorder) ResumeRecording() error {
+	return r.setPaused(false)
+}
+
+func (r *ChromeRecorder) setPaused(paused bool) error {
+	r.mutex.Lock()
+	if !r.isRecording {
+		r.mutex.Unlock()
+		return fmt.Errorf("no recording in progress")
+	}
+	if r.isPaused == paused {
+		r.mutex.Unlock()
+		if paused {
+			return fmt.Errorf("recording is already paused")
+		}
+		return fmt.Errorf("recording is not paused")
+	}
+	r.isPaused = paused
+	r.mutex.Unlock()
+
+	// Stop the page from buffering events as well, so nothing typed while
+	// paused is ever transferred to the server
+	if err := r.syncPageState(); err != nil {
+		log.Printf("Failed to toggle page recorder for session %s: %v", r.sessionID, err)
+	}
+
+	r.notifyStatus()
+	return nil
+}
+
+// listenForEvents records the events reported through the binding in the
+// order the page emitted them, until the browser goes away.
+func (r *ChromeRecorder) listenForEvents(events *eventQueue) {
 	for {
 		select {
 		case <-r.ctx.Done():
+			// The browser was closed or crashed; keep the captured steps so
+			// the session can still be saved
+			r.mutex.Lock()
+			r.isRecording = false
+			r.isPaused = false
+			r.mutex.Unlock()
 			return
-		case <-ticker.C:
-			if !r.isRecording {
-				return
+		case <-events.ready:
+			for _, payload := range events.drain() {
+				var event RecordStep
+				if err := json.Unmarshal([]byte(payload), &event); err != nil {
+					log.Printf("Invalid recorder event for session %s: %v", r.sessionID, err)
+					continue
+				}
+				r.addEvents([]RecordStep{event})
 			}
+		}
+	}
+}
 
-			var events []RecordStep
-			err := chromedp.Run(r.ctx,
-				chromedp.Evaluate(`window.autoUIRecorder && window.autoUIRecorder.getEvents()`, &events),
-			)
+// eventQueue hands the events reported by the page from chromedp's event
+// loop, which must never block, to listenForEvents.
+type eventQueue struct {
+	mutex   sync.Mutex
+	pending []string
+	ready   chan struct{}
+}
 
-			if err != nil {
-				log.Printf("Error getting events: %v", err)
-				continue
-			}
+func newEventQueue() *eventQueue {
+	return &eventQueue{ready: make(chan struct{}, 1)}
+}
 
-			if len(events) > 0 {
-				r.mutex.Lock()
-				r.steps = append(r.steps, events...)
-				r.mutex.Unlock()
+func (q *eventQueue) push(payload string) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, payload)
+	q.mutex.Unlock()
 
-				// Send events via WebSocket if connected
-				if r.wsConn != nil {
-					for _, event := range events {
-						eventData, _ := json.Marshal(event)
-						r.wsConn.WriteMessage(websocket.TextMessage, eventData)
-					}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) drain() []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// syncPageState applies the pause and assert state to the current document
+// and installs it for every document the tab loads later, which would start
+// recording in its initial state otherwise.
+func (r *ChromeRecorder) syncPageState() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+
+	r.mutex.RLock()
+	ctx := r.ctx
+	assertMode := "null"
+	if r.assertMode != "" {
+		assertMode = strconv.Quote(r.assertMode)
+	}
+	state := fmt.Sprintf(`{isRecording: %t, assertMode: %s}`, !r.isPaused, assertMode)
+	r.mutex.RUnlock()
+
+	script := fmt.Sprintf(`window.autoUIRecorderState = %s;
+window.autoUIRecorder && Object.assign(window.autoUIRecorder, window.autoUIRecorderState);`, state)
+
+	return chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			if r.stateScriptID != "" {
+				if err := page.RemoveScriptToEvaluateOnNewDocument(r.stateScriptID).Do(ctx); err != nil {
+					return err
 				}
 			}
+			id, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
+			if err != nil {
+				return err
+			}
+			r.stateScriptID = id
+			return nil
+		}),
+		chromedp.Evaluate(script, nil),
+	)
+}
+
+// addEvents records events reported by the page and tells viewers which
+// steps were added or changed by them.
+func (r *ChromeRecorder) addEvents(events []RecordStep) {
+	if len(events) == 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	if r.isPaused {
+		// Events buffered right before the pause are discarded
+		r.mutex.Unlock()
+		return
+	}
+
+	var messages []Message
+	resync := false
+	assertDone := false
+	r.rawSteps = append(r.rawSteps, events...)
+	for _, event := range events {
+		if event.Type == "assert" && r.assertMode != "" {
+			// The page left assert mode when recording the assertion
+			r.assertMode = ""
+			assertDone = true
+		}
+
+		prevLen := len(r.steps)
+		var prevLast RecordStep
+		if prevLen > 0 {
+			prevLast = r.steps[prevLen-1]
+		}
+
+		r.steps = mergeStep(r.steps, event)
+
+		switch last := len(r.steps) - 1; {
+		case len(r.steps) > prevLen:
+			messages = append(messages, newMessage(MessageStepAdded, StepData{Index: last, Step: r.steps[last]}))
+		case len(r.steps) < prevLen:
+			// Steps were folded away, viewers need the whole list again
+			resync = true
+		case prevLen > 0 && !reflect.DeepEqual(prevLast, r.steps[last]):
+			messages = append(messages, newMessage(MessageStepUpdated, StepData{Index: last, Step: r.steps[last]}))
+		}
+	}
+	r.lastActivity = time.Now()
+	r.mutex.Unlock()
+
+	if assertDone {
+		if err := r.syncPageState(); err != nil {
+			log.Printf("Failed to update page recorder for session %s: %v", r.sessionID, err)
 		}
 	}
+
+	if resync {
+		r.notifySteps()
+		return
+	}
+	for _, msg := range messages {
+		r.broadcast(msg)
+	}
 }
 
-func (r *ChromeRecorder) SetWebSocketConnection(conn *websocket.Conn) {
+// SetAssertMode makes the next click in the page record an assertion of the
+// given kind on the clicked element instead of a click step.
+func (r *ChromeRecorder) SetAssertMode(assertion string) error {
+	if !IsValidAssertion(assertion) {
+		return fmt.Errorf("unsupported assertion type: %s", assertion)
+	}
+
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	r.wsConn = conn
+	if !r.isRecording {
+		r.mutex.Unlock()
+		return fmt.Errorf("no recording in progress")
+	}
+	r.assertMode = assertion
+	r.mutex.Unlock()
+
+	// Kept on the server too, so it survives the page navigating away
+	// before the element is clicked
+	return r.syncPageState()
 }
 
-func (rm *RecorderManager) StartRecording(sessionID, targetURL string, device DeviceInfo) error {
+// IsValidAssertion reports whether assertion is a supported assert step kind.
+func IsValidAssertion(assertion string) bool {
+	switch assertion {
+	case "text", "value", "visible", "exists":
+		return true
+	}
+	return false
+}
+
+func (r *ChromeRecorder) notifyStatus() {
+	r.broadcast(r.statusMessage())
+}
+
+func (rm *RecorderManager) StartRecording(sessionID, targetURL string, device DeviceInfo, options StartOptions) error {
 	rm.mutex.Lock()
 	defer rm.mutex.Unlock()
 
@@ -206,7 +490,7 @@ func (rm *RecorderManager) StartRecording(sessionID, targetURL string, device De
 		return fmt.Errorf("recording session %s already exists", sessionID)
 	}
 
-	recorder := NewChromeRecorder(sessionID, device)
+	recorder := NewChromeRecorder(sessionID, device, options)
 	err := recorder.StartRecording(targetURL)
 	if err != nil {
 		return err
@@ -243,6 +527,38 @@ func (rm *RecorderManager) GetRecorder(sessionID string) (*ChromeRecorder, bool)
 	return recorder, exists
 }
 
+func (rm *RecorderManager) PauseRecording(sessionID string) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.PauseRecording()
+}
+
+func (rm *RecorderManager) ResumeRecording(sessionID string) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.ResumeRecording()
+}
+
+// getRecorder looks up a session without holding the manager lock while the
+// caller talks to the browser.
+func (rm *RecorderManager) getRecorder(sessionID string) (*ChromeRecorder, error) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	recorder, exists := rm.recorders[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("recording session %s not found", sessionID)
+	}
+
+	// Every operation on a session counts as activity for the idle timeout
+	recorder.touch()
+	return recorder, nil
+}
+
 func (rm *RecorderManager) GetRecordingStatus(sessionID string) (bool, []RecordStep, error) {
 	rm.mutex.RLock()
 	defer rm.mutex.RUnlock()
@@ -255,35 +571,70 @@ func (rm *RecorderManager) GetRecordingStatus(sessionID string) (bool, []RecordS
 	return recorder.IsRecording(), recorder.GetSteps(), nil
 }
 
+func (rm *RecorderManager) SetAssertMode(sessionID, assertion string) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.SetAssertMode(assertion)
+}
+
+func (rm *RecorderManager) GetRawSteps(sessionID string) ([]RecordStep, error) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	recorder, exists := rm.recorders[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("recording session %s not found", sessionID)
+	}
+
+	return recorder.GetRawSteps(), nil
+}
+
 func (rm *RecorderManager) CleanupRecording(sessionID string) error {
 	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-
-	if _, exists := rm.recorders[sessionID]; exists {
+	recorder, exists := rm.recorders[sessionID]
+	if exists {
 		delete(rm.recorders, sessionID)
 	}
+	rm.mutex.Unlock()
+
+	if exists {
+		recorder.close()
+	}
 	return nil
 }
 
 func getRecordingScript() string {
 	return `
 (function() {
-	if (window.autoUIRecorder) return;
+	// Steps are replayed against the top-level document only
+	if (window.autoUIRecorder || window.top !== window) return;
 	
 	window.autoUIRecorder = {
-		events: [],
 		isRecording: true,
+		assertMode: null,
+		suppressClick: false,
 		
 		addEvent: function(event) {
-			if (this.isRecording) {
-				this.events.push(event);
+			if (this.isRecording && typeof window.` + eventBindingName + ` === 'function') {
+				window.` + eventBindingName + `(JSON.stringify(event));
 			}
 		},
 		
-		getEvents: function() {
-			const events = [...this.events];
-			this.events = [];
-			return events;
+		setAssertMode: function(assertion) {
+			this.assertMode = assertion || null;
+		},
+		
+		getAssertValue: function(element, assertion) {
+			switch (assertion) {
+				case 'text':
+					return (element.innerText || element.textContent || '').trim();
+				case 'value':
+					return element.value !== undefined ? String(element.value) : '';
+				default:
+					return '';
+			}
 		},
 		
 		getSelector: function(element) {
@@ -314,20 +665,53 @@ func getRecordingScript() string {
 		}
 	};
 	
+	// Pause and assert state set by the server, when the state script ran
+	// first for this document
+	if (window.autoUIRecorderState) {
+		Object.assign(window.autoUIRecorder, window.autoUIRecorderState);
+	}
+	
 	// Click events
 	document.addEventListener('click', function(event) {
-		if (event.isTrusted) {
+		if (!event.isTrusted) {
+			return;
+		}
+		
+		// The click that ends a pointer drag is part of the drag
+		if (window.autoUIRecorder.suppressClick) {
+			window.autoUIRecorder.suppressClick = false;
+			return;
+		}
+		
+		// In assertion mode the click selects the element to assert on
+		// and must not reach the page
+		const assertion = window.autoUIRecorder.assertMode;
+		if (assertion) {
+			event.preventDefault();
+			event.stopPropagation();
+			window.autoUIRecorder.assertMode = null;
 			window.autoUIRecorder.addEvent({
-				type: 'click',
+				type: 'assert',
 				selector: window.autoUIRecorder.getSelector(event.target),
-				coordinates: window.autoUIRecorder.getCoordinates(event),
+				value: window.autoUIRecorder.getAssertValue(event.target, assertion),
 				timestamp: Date.now(),
 				options: {
-					button: event.button,
-					detail: event.detail
+					assertion: assertion
 				}
 			});
+			return;
 		}
+		
+		window.autoUIRecorder.addEvent({
+			type: 'click',
+			selector: window.autoUIRecorder.getSelector(event.target),
+			coordinates: window.autoUIRecorder.getCoordinates(event),
+			timestamp: Date.now(),
+			options: {
+				button: event.button,
+				detail: event.detail
+			}
+		});
 	}, true);
 	
 	// Input events
@@ -431,6 +815,23 @@ func getRecordingScript() string {
 	document.addEventListener('change', function(event) {
 		if (event.isTrusted && event.target.tagName) {
 			const tagName = event.target.tagName.toLowerCase();
+			if (tagName === 'input' && event.target.type === 'file') {
+				// Only the names are recorded, replays use the files attached
+				// to the test case
+				const files = Array.prototype.map.call(event.target.files || [], function(file) {
+					return file.name;
+				});
+				window.autoUIRecorder.addEvent({
+					type: 'upload',
+					selector: window.autoUIRecorder.getSelector(event.target),
+					value: files.join(', '),
+					timestamp: Date.now(),
+					options: {
+						files: files
+					}
+				});
+				return;
+			}
 			if (tagName === 'select' || tagName === 'input') {
 				window.autoUIRecorder.addEvent({
 					type: 'change',
@@ -445,7 +846,175 @@ func getRecordingScript() string {
 		}
 	}, true);
 	
+	// Double clicks
+	document.addEventListener('dblclick', function(event) {
+		if (event.isTrusted && !window.autoUIRecorder.assertMode) {
+			window.autoUIRecorder.addEvent({
+				type: 'dblclick',
+				selector: window.autoUIRecorder.getSelector(event.target),
+				coordinates: window.autoUIRecorder.getCoordinates(event),
+				timestamp: Date.now()
+			});
+		}
+	}, true);
+	
+	// Right clicks
+	document.addEventListener('contextmenu', function(event) {
+		if (event.isTrusted && !window.autoUIRecorder.assertMode) {
+			window.autoUIRecorder.addEvent({
+				type: 'contextmenu',
+				selector: window.autoUIRecorder.getSelector(event.target),
+				coordinates: window.autoUIRecorder.getCoordinates(event),
+				timestamp: Date.now()
+			});
+		}
+	}, true);
+	
+	// Hover. Resting on an element is only recorded if it changed the page
+	// meanwhile, e.g. opened a menu or showed a tooltip, otherwise every
+	// pointer movement would end up in the recording.
+	const hover = { element: null, timer: null, mutated: false, visible: 0 };
+	
+	const countVisible = function(element) {
+		const children = element.querySelectorAll('*');
+		let count = 0;
+		for (let i = 0; i < children.length && i < 500; i++) {
+			if (children[i].offsetParent !== null) {
+				count++;
+			}
+		}
+		return count;
+	};
+	
+	const cancelHover = function() {
+		clearTimeout(hover.timer);
+		hover.element = null;
+		hover.timer = null;
+	};
+	
+	new MutationObserver(function() {
+		if (hover.timer) {
+			hover.mutated = true;
+		}
+	}).observe(document.documentElement, {
+		childList: true,
+		subtree: true,
+		attributes: true,
+		attributeFilter: ['class', 'style', 'hidden', 'aria-expanded']
+	});
+	
+	document.addEventListener('mouseover', function(event) {
+		const element = event.target;
+		if (!event.isTrusted || element === hover.element || element === document.body || element === document.documentElement) {
+			return;
+		}
+		cancelHover();
+		
+		hover.element = element;
+		hover.mutated = false;
+		hover.visible = countVisible(element);
+		hover.timer = setTimeout(function() {
+			hover.timer = null;
+			// CSS-only :hover menus don't mutate the DOM but reveal children
+			if (hover.mutated || countVisible(element) !== hover.visible) {
+				window.autoUIRecorder.addEvent({
+					type: 'hover',
+					selector: window.autoUIRecorder.getSelector(element),
+					timestamp: Date.now(),
+					options: {
+						dwell: ` + strconv.Itoa(hoverDwellMillis) + `
+					}
+				});
+			}
+		}, ` + strconv.Itoa(hoverDwellMillis) + `);
+	}, true);
+	
+	document.addEventListener('mouseout', function(event) {
+		if (hover.element && !hover.element.contains(event.relatedTarget)) {
+			cancelHover();
+		}
+	}, true);
+	
+	// Drag and drop. HTML5 drags are reported by drag events, pointer-based
+	// drags (sliders, sortable lists, canvases) by moving with the button held.
+	let dragSource = null;
+	let pointerDrag = null;
+	
+	document.addEventListener('dragstart', function(event) {
+		if (event.isTrusted) {
+			pointerDrag = null;
+			dragSource = event.target;
+		}
+	}, true);
+	
+	document.addEventListener('drop', function(event) {
+		if (event.isTrusted && dragSource) {
+			window.autoUIRecorder.addEvent({
+				type: 'drag',
+				selector: window.autoUIRecorder.getSelector(dragSource),
+				timestamp: Date.now(),
+				options: {
+					mode: 'html5',
+					target: window.autoUIRecorder.getSelector(event.target)
+				}
+			});
+		}
+		dragSource = null;
+	}, true);
+	
+	document.addEventListener('dragend', function() {
+		dragSource = null;
+	}, true);
+	
+	document.addEventListener('mousedown', function(event) {
+		cancelHover();
+		
+		const tagName = event.target.tagName ? event.target.tagName.toLowerCase() : '';
+		if (!event.isTrusted || event.button !== 0 || window.autoUIRecorder.assertMode ||
+			tagName === 'input' || tagName === 'textarea' || tagName === 'select' || event.target.isContentEditable) {
+			return;
+		}
+		pointerDrag = { element: event.target, x: event.clientX, y: event.clientY, moved: false };
+	}, true);
+	
+	document.addEventListener('mousemove', function(event) {
+		if (pointerDrag && !pointerDrag.moved &&
+			Math.hypot(event.clientX - pointerDrag.x, event.clientY - pointerDrag.y) > ` + strconv.Itoa(dragThresholdPixels) + `) {
+			pointerDrag.moved = true;
+		}
+	}, true);
+	
+	document.addEventListener('mouseup', function(event) {
+		const drag = pointerDrag;
+		pointerDrag = null;
+		
+		// Selecting text with the mouse is not a drag
+		if (!event.isTrusted || !drag || !drag.moved || String(window.getSelection()).length > 0) {
+			return;
+		}
+		
+		window.autoUIRecorder.suppressClick = true;
+		setTimeout(function() {
+			window.autoUIRecorder.suppressClick = false;
+		}, 0);
+		
+		const target = document.elementFromPoint(event.clientX, event.clientY) || event.target;
+		window.autoUIRecorder.addEvent({
+			type: 'drag',
+			selector: window.autoUIRecorder.getSelector(drag.element),
+			coordinates: {
+				dx: event.clientX - drag.x,
+				dy: event.clientY - drag.y
+			},
+			timestamp: Date.now(),
+			options: {
+				mode: 'pointer',
+				target: window.autoUIRecorder.getSelector(target)
+			}
+		});
+	}, true);
+	
 	console.log('AutoUI Recorder initialized');
 })();
 `
-}
\ No newline at end of file
+}
@@ -0,0 +1,121 @@
+package recorder
+
+import "unicode/utf8"
+
+// Scroll events on the same target closer together than this are treated as
+// one continuous scroll and only the final position is kept.
+const scrollDebounceMillis = 800
+
+// mergeStep appends a raw recorded event to the processed step list, folding
+// it into the tail where it is redundant. The browser reports one input per
+// keystroke, a scroll per frame and a keydown for every key, so replaying the
+// raw stream step by step is slow and noisy.
+func mergeStep(steps []RecordStep, event RecordStep) []RecordStep {
+	switch event.Type {
+	case "keydown":
+		// Modifier keys on their own never change the page
+		switch event.Value {
+		case "Shift", "Control", "Alt", "Meta", "CapsLock":
+			return steps
+		}
+
+	case "input":
+		// Keystrokes that produced this input are already represented by its value
+		for len(steps) > 0 && isTextEditingKeydown(steps[len(steps)-1], event.Selector) {
+			steps = steps[:len(steps)-1]
+		}
+
+		// Consecutive inputs on the same field collapse into the final value
+		if last := lastStep(steps); last != nil && last.Type == "input" && last.Selector == event.Selector {
+			last.Value = event.Value
+			last.Timestamp = event.Timestamp
+			return steps
+		}
+
+	case "dblclick":
+		// The browser reports both clicks of a double-click before the dblclick
+		for i := 0; i < 2; i++ {
+			if last := lastStep(steps); last != nil && last.Type == "click" && last.Selector == event.Selector {
+				steps = steps[:len(steps)-1]
+			}
+		}
+
+	case "hover":
+		if last := lastStep(steps); last != nil && last.Type == "hover" && last.Selector == event.Selector {
+			last.Timestamp = event.Timestamp
+			return steps
+		}
+
+	case "upload":
+		// The click that opened the file chooser is replaced by setting the files
+		if last := lastStep(steps); last != nil && last.Type == "click" && last.Selector == event.Selector {
+			*last = event
+			return steps
+		}
+
+	case "scroll":
+		if last := lastStep(steps); last != nil && last.Type == "scroll" && last.Selector == event.Selector &&
+			event.Timestamp-last.Timestamp < scrollDebounceMillis {
+			last.Coordinates = event.Coordinates
+			last.Timestamp = event.Timestamp
+			return steps
+		}
+
+	case "change":
+		last := lastStep(steps)
+		if last == nil || last.Selector != event.Selector {
+			break
+		}
+
+		// Text fields fire change on blur with the value the input already set
+		if last.Type == "input" && last.Value == event.Value {
+			return steps
+		}
+
+		// Clicking a checkbox or radio toggles it, so the click alone replays
+		// the change. For selects and other controls the change carries the value.
+		if last.Type == "click" {
+			if isToggleChange(event) {
+				return steps
+			}
+			*last = event
+			return steps
+		}
+	}
+
+	return append(steps, event)
+}
+
+func lastStep(steps []RecordStep) *RecordStep {
+	if len(steps) == 0 {
+		return nil
+	}
+	return &steps[len(steps)-1]
+}
+
+// isTextEditingKeydown reports whether step is a keydown on selector that only
+// edits text (printable characters, Backspace, Delete) and will be reflected by
+// the following input event. Keys like Enter or Tab are kept.
+func isTextEditingKeydown(step RecordStep, selector string) bool {
+	if step.Type != "keydown" || step.Selector != selector {
+		return false
+	}
+
+	if ctrl, _ := step.Options["ctrlKey"].(bool); ctrl {
+		return false
+	}
+	if meta, _ := step.Options["metaKey"].(bool); meta {
+		return false
+	}
+
+	switch step.Value {
+	case "Backspace", "Delete":
+		return true
+	}
+	return utf8.RuneCountInString(step.Value) == 1
+}
+
+func isToggleChange(step RecordStep) bool {
+	inputType, _ := step.Options["type"].(string)
+	return inputType == "checkbox" || inputType == "radio"
+}
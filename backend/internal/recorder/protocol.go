@@ -0,0 +1,245 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolVersion is the version of the recording WebSocket protocol. Clients
+// may omit the version on commands; newer versions are rejected.
+const ProtocolVersion = 1
+
+// Messages sent from the server to viewers
+const (
+	MessageStepAdded   = "step_added"
+	MessageStepUpdated = "step_updated"
+	MessageSteps       = "steps" // full step list after edits or on connect
+	MessageStatus      = "status"
+	MessageError       = "error"
+	MessageHeartbeat   = "heartbeat"
+	MessageScreenshot  = "screenshot"
+	MessageFrame       = "frame" // screencast frame of a headless session
+)
+
+// Commands sent from viewers to the server
+const (
+	CommandPause          = "pause"
+	CommandResume         = "resume"
+	CommandAddAssertion   = "add_assertion"
+	CommandInsertStep     = "insert_step"
+	CommandUpdateStep     = "update_step"
+	CommandDeleteStep     = "delete_step"
+	CommandMoveStep       = "move_step"
+	CommandTakeScreenshot = "take_screenshot"
+	CommandInput          = "input"
+	CommandHeartbeat      = "heartbeat"
+)
+
+// Message is the envelope of every message on the recording WebSocket.
+type Message struct {
+	Version   int         `json:"version"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"` // echoes the command that caused the message
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+type StepData struct {
+	Index int        `json:"index"`
+	Step  RecordStep `json:"step"`
+}
+
+type StepsData struct {
+	Steps []RecordStep `json:"steps"`
+}
+
+type StatusData struct {
+	IsRecording bool `json:"is_recording"`
+	IsPaused    bool `json:"is_paused"`
+	Headless    bool `json:"headless"`
+	StepCount   int  `json:"step_count"`
+}
+
+type ErrorData struct {
+	Message string `json:"message"`
+}
+
+type ScreenshotData struct {
+	Data string `json:"data"` // Base64-encoded PNG
+}
+
+// Command is a message sent by a viewer to control the session.
+type Command struct {
+	Version   int         `json:"version"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id"`
+	Index     *int        `json:"index"`
+	To        int         `json:"to"`
+	Assertion string      `json:"assertion"`
+	Step      RecordStep  `json:"step"`
+	Input     *InputEvent `json:"input"`
+}
+
+func newMessage(messageType string, data interface{}) Message {
+	return Message{
+		Version:   ProtocolVersion,
+		Type:      messageType,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      data,
+	}
+}
+
+func (r *ChromeRecorder) statusMessage() Message {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return newMessage(MessageStatus, StatusData{
+		IsRecording: r.isRecording,
+		IsPaused:    r.isPaused,
+		Headless:    r.options.Headless,
+		StepCount:   len(r.steps),
+	})
+}
+
+// ServeViewer attaches conn to the session and handles its commands until
+// the connection is closed. The viewer first receives the current status and
+// step list, then every change as it happens.
+func (r *ChromeRecorder) ServeViewer(conn *websocket.Conn) {
+	v := r.addViewer(conn)
+	if v == nil {
+		conn.WriteJSON(r.statusMessage())
+		conn.WriteJSON(newMessage(MessageError, ErrorData{Message: "recording session closed"}))
+		return
+	}
+	defer r.removeViewer(conn)
+
+	r.sendTo(v, r.statusMessage())
+	r.sendTo(v, newMessage(MessageSteps, StepsData{Steps: r.GetSteps()}))
+
+	conn.SetReadDeadline(time.Now().Add(viewerPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(viewerPongWait))
+		return nil
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(viewerPingPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := v.ping(); err != nil {
+					return
+				}
+				r.sendTo(v, newMessage(MessageHeartbeat, nil))
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error for session %s: %v", r.sessionID, err)
+			}
+			return
+		}
+		r.handleCommand(v, data)
+	}
+}
+
+// handleCommand applies a command received from a viewer. The same operations
+// are available through the REST API. Failures are reported back to the
+// viewer that sent the command rather than closing the socket.
+func (r *ChromeRecorder) handleCommand(v *viewer, data []byte) {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		r.sendTo(v, newMessage(MessageError, ErrorData{Message: fmt.Sprintf("invalid command: %v", err)}))
+		return
+	}
+
+	r.touch()
+
+	reply := func(msg Message) {
+		msg.RequestID = cmd.RequestID
+		r.sendTo(v, msg)
+	}
+
+	if cmd.Version > ProtocolVersion {
+		reply(newMessage(MessageError, ErrorData{
+			Message: fmt.Sprintf("unsupported protocol version %d, server supports %d", cmd.Version, ProtocolVersion),
+		}))
+		return
+	}
+
+	index := -1
+	if cmd.Index != nil {
+		index = *cmd.Index
+	}
+
+	var err error
+	switch cmd.Type {
+	case CommandPause:
+		err = r.PauseRecording()
+	case CommandResume:
+		err = r.ResumeRecording()
+	case CommandAddAssertion:
+		err = r.SetAssertMode(cmd.Assertion)
+	case CommandInsertStep:
+		if err = ValidateStep(cmd.Step); err == nil {
+			err = r.InsertStep(index, cmd.Step)
+		}
+	case CommandUpdateStep:
+		if err = ValidateStep(cmd.Step); err == nil {
+			err = r.UpdateStep(index, cmd.Step)
+		}
+	case CommandDeleteStep:
+		err = r.DeleteStep(index)
+	case CommandMoveStep:
+		err = r.MoveStep(index, cmd.To)
+	case CommandInput:
+		err = r.DispatchInput(cmd.Input)
+	case CommandTakeScreenshot:
+		var screenshot string
+		if screenshot, err = r.TakeScreenshot(); err == nil {
+			reply(newMessage(MessageScreenshot, ScreenshotData{Data: screenshot}))
+		}
+	case CommandHeartbeat:
+		reply(newMessage(MessageHeartbeat, nil))
+	default:
+		err = fmt.Errorf("unsupported command: %s", cmd.Type)
+	}
+
+	if err != nil {
+		reply(newMessage(MessageError, ErrorData{Message: err.Error()}))
+	}
+}
+
+// TakeScreenshot captures the current page and returns it base64 encoded.
+func (r *ChromeRecorder) TakeScreenshot() (string, error) {
+	r.mutex.RLock()
+	isRecording, ctx := r.isRecording, r.ctx
+	r.mutex.RUnlock()
+
+	if !isRecording {
+		return "", fmt.Errorf("no recording in progress")
+	}
+
+	var buf []byte
+	if err := chromedp.Run(ctx, chromedp.CaptureScreenshot(&buf)); err != nil {
+		return "", fmt.Errorf("failed to take screenshot: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
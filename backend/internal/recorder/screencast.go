@@ -0,0 +1,151 @@
+package recorder
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	screencastQuality = 70
+	// Frames waiting to be forwarded beyond this are dropped, the next one
+	// supersedes them anyway
+	screencastBuffer = 4
+)
+
+// InputEvent is a mouse, keyboard or touch event captured by the frontend on
+// the screencast view and replayed in the headless browser. Coordinates are
+// CSS pixels relative to the page viewport.
+type InputEvent struct {
+	Type       string       `json:"type"` // CDP event type, e.g. mousePressed, keyDown, touchStart
+	X          float64      `json:"x"`
+	Y          float64      `json:"y"`
+	Button     string       `json:"button"`
+	ClickCount int64        `json:"click_count"`
+	DeltaX     float64      `json:"delta_x"`
+	DeltaY     float64      `json:"delta_y"`
+	Modifiers  int64        `json:"modifiers"` // Alt=1, Ctrl=2, Meta=4, Shift=8
+	Key        string       `json:"key"`
+	Code       string       `json:"code"`
+	Text       string       `json:"text"`
+	KeyCode    int64        `json:"key_code"`
+	Points     []TouchPoint `json:"points"`
+}
+
+// FrameData is a screencast frame pushed to viewers of a headless session.
+type FrameData struct {
+	Data     string                        `json:"data"` // Base64-encoded JPEG
+	Metadata *page.ScreencastFrameMetadata `json:"metadata"`
+}
+
+type TouchPoint struct {
+	X  float64 `json:"x"`
+	Y  float64 `json:"y"`
+	ID float64 `json:"id"`
+}
+
+// startScreencast streams the headless page to the WebSocket client. Chrome
+// only sends the next frame once the previous one is acknowledged.
+func (r *ChromeRecorder) startScreencast() error {
+	frames := make(chan *page.EventScreencastFrame, screencastBuffer)
+
+	chromedp.ListenTarget(r.ctx, func(ev interface{}) {
+		frame, ok := ev.(*page.EventScreencastFrame)
+		if !ok {
+			return
+		}
+		select {
+		case frames <- frame:
+		default:
+		}
+	})
+
+	go func() {
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case frame := <-frames:
+				if err := chromedp.Run(r.ctx, page.ScreencastFrameAck(frame.SessionID)); err != nil {
+					log.Printf("Failed to acknowledge screencast frame for session %s: %v", r.sessionID, err)
+				}
+				r.broadcast(newMessage(MessageFrame, FrameData{
+					Data:     frame.Data,
+					Metadata: frame.Metadata,
+				}))
+			}
+		}
+	}()
+
+	return chromedp.Run(r.ctx, page.StartScreencast().
+		WithFormat(page.ScreencastFormatJpeg).
+		WithQuality(screencastQuality).
+		WithMaxWidth(int64(r.deviceInfo.Width)).
+		WithMaxHeight(int64(r.deviceInfo.Height)))
+}
+
+// DispatchInput replays a user input event from the screencast view in the
+// browser. Events dispatched through CDP are trusted, so the recording script
+// captures them like real user input.
+func (r *ChromeRecorder) DispatchInput(event *InputEvent) error {
+	if event == nil {
+		return fmt.Errorf("input event is required")
+	}
+
+	r.mutex.RLock()
+	isRecording, headless, ctx := r.isRecording, r.options.Headless, r.ctx
+	r.mutex.RUnlock()
+
+	if !isRecording {
+		return fmt.Errorf("no recording in progress")
+	}
+	if !headless {
+		return fmt.Errorf("input relay is only available for headless recordings")
+	}
+
+	modifiers := input.Modifier(event.Modifiers)
+
+	var action chromedp.Action
+	switch input.MouseType(event.Type) {
+	case input.MousePressed, input.MouseReleased, input.MouseMoved, input.MouseWheel:
+		button := input.MouseButton(event.Button)
+		if button == "" {
+			button = input.None
+		}
+		action = input.DispatchMouseEvent(input.MouseType(event.Type), event.X, event.Y).
+			WithButton(button).
+			WithClickCount(event.ClickCount).
+			WithDeltaX(event.DeltaX).
+			WithDeltaY(event.DeltaY).
+			WithModifiers(modifiers)
+	}
+
+	switch input.KeyType(event.Type) {
+	case input.KeyDown, input.KeyUp, input.KeyRawDown, input.KeyChar:
+		action = input.DispatchKeyEvent(input.KeyType(event.Type)).
+			WithKey(event.Key).
+			WithCode(event.Code).
+			WithText(event.Text).
+			WithWindowsVirtualKeyCode(event.KeyCode).
+			WithModifiers(modifiers)
+	}
+
+	switch input.TouchType(event.Type) {
+	case input.TouchStart, input.TouchEnd, input.TouchMove, input.TouchCancel:
+		points := make([]*input.TouchPoint, 0, len(event.Points))
+		for _, p := range event.Points {
+			points = append(points, &input.TouchPoint{X: p.X, Y: p.Y, ID: p.ID})
+		}
+		action = input.DispatchTouchEvent(input.TouchType(event.Type), points).
+			WithModifiers(modifiers)
+	}
+
+	if action == nil {
+		return fmt.Errorf("unsupported input event type: %s", event.Type)
+	}
+
+	return chromedp.Run(ctx, action)
+}
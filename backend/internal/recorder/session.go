@@ -0,0 +1,152 @@
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SessionInfo summarizes a recording session for administration.
+type SessionInfo struct {
+	SessionID    string    `json:"session_id"`
+	OwnerID      uint      `json:"owner_id"`
+	TargetURL    string    `json:"target_url"`
+	IsRecording  bool      `json:"is_recording"`
+	IsPaused     bool      `json:"is_paused"`
+	Headless     bool      `json:"headless"`
+	StepCount    int       `json:"step_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+func (r *ChromeRecorder) touch() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastActivity = time.Now()
+}
+
+func (r *ChromeRecorder) OwnerID() uint {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.options.OwnerID
+}
+
+func (r *ChromeRecorder) info() SessionInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return SessionInfo{
+		SessionID:    r.sessionID,
+		OwnerID:      r.options.OwnerID,
+		TargetURL:    r.targetURL,
+		IsRecording:  r.isRecording,
+		IsPaused:     r.isPaused,
+		Headless:     r.options.Headless,
+		StepCount:    len(r.steps),
+		CreatedAt:    r.createdAt,
+		LastActivity: r.lastActivity,
+	}
+}
+
+// close releases the browser of a session that is being discarded. Viewers
+// are told the session ended and disconnected, so nothing keeps the discarded
+// session referenced.
+func (r *ChromeRecorder) close() {
+	r.mutex.Lock()
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.isRecording = false
+	r.isPaused = false
+	r.closed = true
+	viewers := make([]*viewer, 0, len(r.viewers))
+	for _, v := range r.viewers {
+		viewers = append(viewers, v)
+	}
+	r.mutex.Unlock()
+
+	status := r.statusMessage()
+	for _, v := range viewers {
+		r.sendTo(v, status)
+		r.sendTo(v, newMessage(MessageError, ErrorData{Message: "recording session closed"}))
+		v.close()
+	}
+}
+
+// ListSessions returns every session currently held in memory.
+func (rm *RecorderManager) ListSessions() []SessionInfo {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	sessions := make([]SessionInfo, 0, len(rm.recorders))
+	for _, recorder := range rm.recorders {
+		sessions = append(sessions, recorder.info())
+	}
+	return sessions
+}
+
+// CloseSession stops the browser of a session and discards it along with any
+// unsaved steps.
+func (rm *RecorderManager) CloseSession(sessionID string) error {
+	rm.mutex.Lock()
+	recorder, exists := rm.recorders[sessionID]
+	if exists {
+		delete(rm.recorders, sessionID)
+	}
+	rm.mutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("recording session %s not found", sessionID)
+	}
+
+	recorder.close()
+	return nil
+}
+
+// CloseAll stops the browsers of every session, discarding unsaved steps. It
+// returns the number of sessions closed.
+func (rm *RecorderManager) CloseAll() int {
+	rm.mutex.Lock()
+	recorders := rm.recorders
+	rm.recorders = make(map[string]*ChromeRecorder)
+	rm.mutex.Unlock()
+
+	for _, recorder := range recorders {
+		recorder.close()
+	}
+	return len(recorders)
+}
+
+// StartReaper periodically closes sessions that have been idle longer than
+// idleTimeout or exist longer than maxLifetime, so abandoned or never saved
+// recordings don't leak browser processes. A zero duration disables that limit.
+func (rm *RecorderManager) StartReaper(idleTimeout, maxLifetime time.Duration) {
+	if idleTimeout <= 0 && maxLifetime <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			for _, session := range rm.ListSessions() {
+				var reason string
+				switch {
+				case idleTimeout > 0 && now.Sub(session.LastActivity) > idleTimeout:
+					reason = "idle timeout"
+				case maxLifetime > 0 && now.Sub(session.CreatedAt) > maxLifetime:
+					reason = "max lifetime exceeded"
+				default:
+					continue
+				}
+
+				if err := rm.CloseSession(session.SessionID); err == nil {
+					log.Printf("Closed recording session %s of user %d: %s", session.SessionID, session.OwnerID, reason)
+				}
+			}
+		}
+	}()
+
+	log.Printf("Recording session reaper started (idle timeout %v, max lifetime %v)", idleTimeout, maxLifetime)
+}
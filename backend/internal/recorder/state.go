@@ -0,0 +1,66 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"autoui-platform/backend/internal/models"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// captureStorage snapshots the cookies and localStorage of the loaded page.
+func captureStorage(ctx context.Context, state *models.StartState) error {
+	var cookies []*network.Cookie
+	var localStorage, origin string
+
+	err := chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			cookies, err = network.GetCookies().Do(ctx)
+			return err
+		}),
+		chromedp.Evaluate(`JSON.stringify(Object.assign({}, window.localStorage))`, &localStorage),
+		chromedp.Evaluate(`window.location.origin`, &origin),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to capture browser state: %w", err)
+	}
+
+	for _, cookie := range cookies {
+		state.Cookies = append(state.Cookies, models.StartCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			HTTPOnly: cookie.HTTPOnly,
+			Secure:   cookie.Secure,
+			SameSite: cookie.SameSite.String(),
+		})
+	}
+
+	state.StorageOrigin = origin
+	if err := json.Unmarshal([]byte(localStorage), &state.LocalStorage); err != nil {
+		return fmt.Errorf("failed to parse localStorage: %w", err)
+	}
+	return nil
+}
+
+// GetStartInfo returns the URL the recording started on and the browser
+// state at that time, as stored with the saved test case.
+func (r *ChromeRecorder) GetStartInfo() (string, models.StartState) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.targetURL, r.startState
+}
+
+func (rm *RecorderManager) GetStartInfo(sessionID string) (string, models.StartState, error) {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return "", models.StartState{}, err
+	}
+	targetURL, state := recorder.GetStartInfo()
+	return targetURL, state, nil
+}
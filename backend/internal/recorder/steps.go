@@ -0,0 +1,154 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+)
+
+// IsManualStepType reports whether stepType can be inserted by hand into a
+// recording rather than captured from the page.
+func IsManualStepType(stepType string) bool {
+	switch stepType {
+	case "wait", "assert", "comment":
+		return true
+	}
+	return false
+}
+
+// ValidateStep checks that a step edited by hand names an action and, unless
+// the action doesn't act on an element, the element's selector.
+func ValidateStep(step RecordStep) error {
+	if step.Type == "" {
+		return fmt.Errorf("step type is required")
+	}
+	switch step.Type {
+	case "wait", "comment", "scroll", "navigate":
+		return nil
+	}
+	if step.Selector == "" {
+		return fmt.Errorf("selector is required for %s steps", step.Type)
+	}
+	return nil
+}
+
+// InsertStep inserts a manual step at index, or appends it when index is
+// negative or past the end.
+func (r *ChromeRecorder) InsertStep(index int, step RecordStep) error {
+	if !IsManualStepType(step.Type) {
+		return fmt.Errorf("unsupported manual step type: %s", step.Type)
+	}
+	if step.Type == "assert" {
+		assertion, _ := step.Options["assertion"].(string)
+		if !IsValidAssertion(assertion) {
+			return fmt.Errorf("unsupported assertion type: %s", assertion)
+		}
+	}
+
+	if step.Options == nil {
+		step.Options = make(map[string]interface{})
+	}
+	step.Options["manual"] = true
+	if step.Timestamp == 0 {
+		step.Timestamp = time.Now().UnixMilli()
+	}
+
+	r.mutex.Lock()
+	if index < 0 || index > len(r.steps) {
+		index = len(r.steps)
+	}
+	r.steps = append(r.steps, RecordStep{})
+	copy(r.steps[index+1:], r.steps[index:])
+	r.steps[index] = step
+	r.mutex.Unlock()
+
+	r.notifySteps()
+	return nil
+}
+
+// UpdateStep replaces the step at index.
+func (r *ChromeRecorder) UpdateStep(index int, step RecordStep) error {
+	if step.Type == "" {
+		return fmt.Errorf("step type is required")
+	}
+
+	r.mutex.Lock()
+	if index < 0 || index >= len(r.steps) {
+		r.mutex.Unlock()
+		return fmt.Errorf("step index %d out of range", index)
+	}
+	if step.Timestamp == 0 {
+		step.Timestamp = r.steps[index].Timestamp
+	}
+	r.steps[index] = step
+	r.mutex.Unlock()
+
+	r.notifySteps()
+	return nil
+}
+
+func (r *ChromeRecorder) DeleteStep(index int) error {
+	r.mutex.Lock()
+	if index < 0 || index >= len(r.steps) {
+		r.mutex.Unlock()
+		return fmt.Errorf("step index %d out of range", index)
+	}
+	r.steps = append(r.steps[:index], r.steps[index+1:]...)
+	r.mutex.Unlock()
+
+	r.notifySteps()
+	return nil
+}
+
+// MoveStep moves the step at from so that it ends up at position to.
+func (r *ChromeRecorder) MoveStep(from, to int) error {
+	r.mutex.Lock()
+	if from < 0 || from >= len(r.steps) || to < 0 || to >= len(r.steps) {
+		r.mutex.Unlock()
+		return fmt.Errorf("step index out of range")
+	}
+	step := r.steps[from]
+	r.steps = append(r.steps[:from], r.steps[from+1:]...)
+	r.steps = append(r.steps[:to], append([]RecordStep{step}, r.steps[to:]...)...)
+	r.mutex.Unlock()
+
+	r.notifySteps()
+	return nil
+}
+
+// notifySteps pushes the full step list to all WebSocket viewers after an edit
+// so that every view of the session stays in sync.
+func (r *ChromeRecorder) notifySteps() {
+	r.broadcast(newMessage(MessageSteps, StepsData{Steps: r.GetSteps()}))
+}
+
+func (rm *RecorderManager) InsertStep(sessionID string, index int, step RecordStep) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.InsertStep(index, step)
+}
+
+func (rm *RecorderManager) UpdateStep(sessionID string, index int, step RecordStep) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.UpdateStep(index, step)
+}
+
+func (rm *RecorderManager) DeleteStep(sessionID string, index int) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.DeleteStep(index)
+}
+
+func (rm *RecorderManager) MoveStep(sessionID string, from, to int) error {
+	recorder, err := rm.getRecorder(sessionID)
+	if err != nil {
+		return err
+	}
+	return recorder.MoveStep(from, to)
+}
@@ -0,0 +1,111 @@
+package recorder
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to a viewer
+	viewerWriteWait = 10 * time.Second
+	// A viewer that hasn't answered a ping within this is considered gone
+	viewerPongWait = 60 * time.Second
+	// Pings and heartbeats are sent at this interval, less than viewerPongWait
+	viewerPingPeriod = 25 * time.Second
+)
+
+// viewer is a WebSocket client attached to a recording session. Several
+// viewers may watch the same session; writes to each connection are
+// serialized because events, frames, edits and pings are pushed from
+// different goroutines.
+type viewer struct {
+	conn  *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (v *viewer) write(data []byte) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.conn.SetWriteDeadline(time.Now().Add(viewerWriteWait))
+	return v.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (v *viewer) ping() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(viewerWriteWait))
+}
+
+// close ends the connection with a close frame; the viewer's read loop then
+// returns.
+func (v *viewer) close() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session closed"),
+		time.Now().Add(viewerWriteWait))
+	v.conn.Close()
+}
+
+// addViewer attaches conn to the session. It returns nil once the session
+// has been closed.
+func (r *ChromeRecorder) addViewer(conn *websocket.Conn) *viewer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	v := &viewer{conn: conn}
+	r.viewers[conn] = v
+	return v
+}
+
+func (r *ChromeRecorder) removeViewer(conn *websocket.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.viewers, conn)
+}
+
+// broadcast writes msg to every connected viewer.
+func (r *ChromeRecorder) broadcast(msg Message) {
+	r.mutex.RLock()
+	viewers := make([]*viewer, 0, len(r.viewers))
+	for _, v := range r.viewers {
+		viewers = append(viewers, v)
+	}
+	r.mutex.RUnlock()
+
+	if len(viewers) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode WebSocket message: %v", err)
+		return
+	}
+
+	for _, v := range viewers {
+		if err := v.write(data); err != nil {
+			log.Printf("WebSocket write error for session %s: %v", r.sessionID, err)
+		}
+	}
+}
+
+// sendTo writes msg to a single viewer only.
+func (r *ChromeRecorder) sendTo(v *viewer, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode WebSocket message: %v", err)
+		return
+	}
+
+	if err := v.write(data); err != nil {
+		log.Printf("WebSocket write error for session %s: %v", r.sessionID, err)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"time"
+)
+
+const (
+	BlackoutWeekly = "weekly"
+	BlackoutDates  = "dates"
+)
+
+// ValidateBlackout checks that a blackout window is complete and well formed.
+func ValidateBlackout(blackout *models.ScheduleBlackout) error {
+	if _, err := loadLocation(blackout.Timezone); err != nil {
+		return err
+	}
+
+	switch blackout.Type {
+	case BlackoutWeekly:
+		if blackout.StartDay < 0 || blackout.StartDay > 6 || blackout.EndDay < 0 || blackout.EndDay > 6 {
+			return fmt.Errorf("day must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		if _, err := minuteOfDay(blackout.StartTime); err != nil {
+			return err
+		}
+		if _, err := minuteOfDay(blackout.EndTime); err != nil {
+			return err
+		}
+	case BlackoutDates:
+		start, err := time.Parse("2006-01-02", blackout.StartDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", blackout.StartDate)
+		}
+		if blackout.EndDate == "" {
+			blackout.EndDate = blackout.StartDate
+		}
+		end, err := time.Parse("2006-01-02", blackout.EndDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date %q, expected YYYY-MM-DD", blackout.EndDate)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("end date is before start date")
+		}
+	default:
+		return fmt.Errorf("unsupported blackout type %q", blackout.Type)
+	}
+	return nil
+}
+
+// BlackoutCovers reports whether t falls into the blackout window. A weekly
+// window whose end is before its start wraps around the weekend, e.g.
+// Friday 18:00 to Monday 08:00.
+func BlackoutCovers(blackout models.ScheduleBlackout, t time.Time) bool {
+	loc, err := loadLocation(blackout.Timezone)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+
+	switch blackout.Type {
+	case BlackoutWeekly:
+		startTime, err := minuteOfDay(blackout.StartTime)
+		if err != nil {
+			return false
+		}
+		endTime, err := minuteOfDay(blackout.EndTime)
+		if err != nil {
+			return false
+		}
+
+		const minutesPerDay = 24 * 60
+		now := int(t.Weekday())*minutesPerDay + t.Hour()*60 + t.Minute()
+		start := blackout.StartDay*minutesPerDay + startTime
+		end := blackout.EndDay*minutesPerDay + endTime
+		if start <= end {
+			return now >= start && now < end
+		}
+		return now >= start || now < end
+
+	case BlackoutDates:
+		date := t.Format("2006-01-02")
+		endDate := blackout.EndDate
+		if endDate == "" {
+			endDate = blackout.StartDate
+		}
+		return date >= blackout.StartDate && date <= endDate
+	}
+	return false
+}
+
+// ProjectBlackouts returns the blackout windows that apply to a project.
+func ProjectBlackouts(projectID uint) ([]models.ScheduleBlackout, error) {
+	var blackouts []models.ScheduleBlackout
+	err := database.DB.Where("status = ? AND (project_id IS NULL OR project_id = ?)", 1, projectID).
+		Find(&blackouts).Error
+	return blackouts, err
+}
+
+// FindBlackout returns the first of blackouts covering t, or nil.
+func FindBlackout(blackouts []models.ScheduleBlackout, t time.Time) *models.ScheduleBlackout {
+	for i := range blackouts {
+		if BlackoutCovers(blackouts[i], t) {
+			return &blackouts[i]
+		}
+	}
+	return nil
+}
+
+func minuteOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
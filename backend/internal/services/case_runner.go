@@ -0,0 +1,44 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"time"
+)
+
+// StartTestCaseRun creates a pending execution of a single test case and
+// queues it. A worker runs it and saves the result once one is free.
+func StartTestCaseRun(testCase models.TestCase, userID uint, isVisual bool) (models.TestExecution, error) {
+	if executor.GlobalExecutor == nil {
+		return models.TestExecution{}, fmt.Errorf("test executor not available")
+	}
+
+	execution := models.TestExecution{
+		TestCaseID:    testCase.ID,
+		ExecutionType: "test_case",
+		Status:        "pending",
+		Priority:      executionPriority(testCase.Priority, testCase.Priority),
+		IsVisual:      isVisual,
+		StartTime:     time.Now(),
+		UserID:        userID,
+		ErrorMessage:  "",
+		ExecutionLogs: "[]",
+		Screenshots:   "[]",
+	}
+
+	if err := database.DB.Create(&execution).Error; err != nil {
+		return models.TestExecution{}, fmt.Errorf("failed to create execution record: %w", err)
+	}
+
+	executor.GlobalExecutor.Enqueue(&execution)
+	return execution, nil
+}
+
+// executionPriority is the queue priority of a test case run: suites are
+// ordered by their own priority and the cases within one by theirs. A test
+// case run on its own ranks like a suite of the case's priority.
+func executionPriority(suitePriority, casePriority int) int {
+	return suitePriority*10 + casePriority
+}
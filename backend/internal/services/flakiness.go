@@ -0,0 +1,97 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"log"
+)
+
+// Flakiness scoring settings, see InitFlakiness.
+var (
+	flakyThreshold = 0.2
+	flakyWindow    = 20
+	flakyMinRuns   = 5
+)
+
+// InitFlakiness sets how test cases are flagged as flaky and rescores a test
+// case whenever one of its executions finishes. The score covers the last
+// window finished executions; a test case is flagged once at least minRuns of
+// them scored threshold or more.
+func InitFlakiness(threshold float64, window, minRuns int) {
+	if threshold > 0 {
+		flakyThreshold = threshold
+	}
+	if window > 0 {
+		flakyWindow = window
+	}
+	if minRuns > 0 {
+		flakyMinRuns = minRuns
+	}
+
+	if executor.GlobalExecutor != nil {
+		executor.GlobalExecutor.OnFinish(UpdateFlakiness)
+	}
+	log.Printf("Flaky test detection enabled (threshold %.2f over the last %d runs)", flakyThreshold, flakyWindow)
+}
+
+// UpdateFlakiness rescores a test case from its recent executions and flags
+// or unflags it.
+func UpdateFlakiness(testCaseID uint) {
+	var executions []models.TestExecution
+	err := database.DB.Select("id", "status", "attempt", "environment_id", "case_revision").
+		Where("test_case_id = ? AND retried = ? AND status IN ?", testCaseID, false, []string{"passed", "failed"}).
+		Order("id DESC").Limit(flakyWindow).Find(&executions).Error
+	if err != nil {
+		log.Printf("Failed to load executions of test case %d for flakiness: %v", testCaseID, err)
+		return
+	}
+
+	score := FlakinessScore(executions)
+	isFlaky := len(executions) >= flakyMinRuns && score >= flakyThreshold
+
+	var testCase models.TestCase
+	if err := database.DB.Select("id", "name", "is_flaky").First(&testCase, testCaseID).Error; err != nil {
+		return
+	}
+
+	// Not an edit of the test case, leave updated_at alone
+	err = database.DB.Model(&testCase).UpdateColumns(map[string]interface{}{
+		"flakiness_score": score,
+		"is_flaky":        isFlaky,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to save flakiness of test case %d: %v", testCaseID, err)
+		return
+	}
+
+	if isFlaky && !testCase.IsFlaky {
+		log.Printf("Test case %d (%s) flagged as flaky, score %.2f", testCaseID, testCase.Name, score)
+	}
+}
+
+// FlakinessScore is the share of executions that were flaky: they passed only
+// on retry, or their result differs from the previous execution of the same
+// test case revision in the same environment. executions are ordered newest
+// first.
+func FlakinessScore(executions []models.TestExecution) float64 {
+	if len(executions) == 0 {
+		return 0
+	}
+
+	flaky := 0
+	previous := make(map[string]string) // revision and environment -> status of the previous run
+	for i := len(executions) - 1; i >= 0; i-- {
+		execution := executions[i]
+		key := fmt.Sprintf("%s/%d", execution.CaseRevision, execution.EnvironmentID)
+
+		status, seen := previous[key]
+		if (seen && status != execution.Status) || (execution.Status == "passed" && execution.Attempt > 1) {
+			flaky++
+		}
+		previous[key] = execution.Status
+	}
+
+	return float64(flaky) / float64(len(executions))
+}
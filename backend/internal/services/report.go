@@ -0,0 +1,125 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"log"
+	"time"
+)
+
+var triggerNames = map[string]string{
+	TriggerManual:   "手动执行",
+	TriggerSchedule: "定时执行",
+	TriggerAPI:      "API执行",
+	TriggerRerun:    "失败重跑",
+}
+
+// CreateTestReport computes the statistics of report from executions, saves
+// it and links the executions to it.
+func CreateTestReport(report *models.TestReport, executions []models.TestExecution) error {
+	AggregateExecutions(report, executions)
+
+	if err := database.DB.Create(report).Error; err != nil {
+		return fmt.Errorf("failed to create test report: %w", err)
+	}
+	if err := database.DB.Model(report).Association("Executions").Replace(executions); err != nil {
+		return fmt.Errorf("failed to associate executions with report: %w", err)
+	}
+	return nil
+}
+
+// AggregateExecutions fills the case counters, times and status of report.
+// Each test case counts once, by its last attempt; the times span every
+// attempt. Interrupted executions are counted as errors and failures of
+// quarantined test cases apart from the failed ones.
+func AggregateExecutions(report *models.TestReport, executions []models.TestExecution) {
+	report.TotalCases, report.PassedCases, report.FailedCases, report.ErrorCases = 0, 0, 0, 0
+	report.PassedOnRetryCases, report.QuarantinedCases = 0, 0
+	report.Status = "completed"
+
+	var startTime, endTime time.Time
+	var totalDuration int // in seconds
+	for _, execution := range executions {
+		if startTime.IsZero() || execution.StartTime.Before(startTime) {
+			startTime = execution.StartTime
+		}
+		if execution.EndTime != nil && execution.EndTime.After(endTime) {
+			endTime = *execution.EndTime
+		}
+		totalDuration += execution.Duration
+
+		// Attempts that were retried are superseded by their retry
+		if execution.Retried {
+			continue
+		}
+		report.TotalCases++
+
+		switch execution.Status {
+		case "passed":
+			report.PassedCases++
+			if execution.Attempt > 1 {
+				report.PassedOnRetryCases++
+			}
+		case "failed":
+			if execution.CountsAsFailure() {
+				report.FailedCases++
+			} else {
+				report.QuarantinedCases++
+			}
+		case "interrupted", "error":
+			report.ErrorCases++
+		case "pending", "running":
+			report.Status = "running"
+		}
+	}
+
+	// Set default end time if no executions have end time
+	if endTime.IsZero() {
+		endTime = time.Now()
+	}
+
+	report.StartTime = startTime
+	report.EndTime = endTime
+	report.Duration = int(endTime.Sub(startTime).Seconds())
+	if report.Duration <= 0 {
+		report.Duration = totalDuration
+	}
+}
+
+// createSuiteRunReport creates the report of a completed suite run, with
+// every attempt of its executions. Runs cancelled before any test case
+// finished get none.
+func createSuiteRunReport(run models.SuiteRun) {
+	if run.PassedCases+run.FailedCases+run.ErrorCases+run.QuarantinedCases == 0 {
+		return
+	}
+
+	var testSuite models.TestSuite
+	if err := database.DB.First(&testSuite, run.TestSuiteID).Error; err != nil {
+		log.Printf("Failed to load test suite %d for the report of suite run %d: %v", run.TestSuiteID, run.ID, err)
+		return
+	}
+
+	var executions []models.TestExecution
+	database.DB.Where("suite_run_id = ?", run.ID).Order("id ASC").Find(&executions)
+
+	trigger := triggerNames[run.Trigger]
+	if trigger == "" {
+		trigger = run.Trigger
+	}
+
+	report := models.TestReport{
+		Name:        fmt.Sprintf("%s - %s %s", testSuite.Name, trigger, run.StartTime.Format("2006-01-02 15:04:05")),
+		ProjectID:   testSuite.ProjectID,
+		TestSuiteID: &testSuite.ID,
+		SuiteRunID:  &run.ID,
+		UserID:      run.UserID,
+	}
+	if err := CreateTestReport(&report, executions); err != nil {
+		log.Printf("Failed to create report of suite run %d: %v", run.ID, err)
+		return
+	}
+
+	log.Printf("Created test report %d for suite run %d of test suite %d", report.ID, run.ID, testSuite.ID)
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"archive/zip"
+	"autoui-platform/backend/internal/executor"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// allureResultsDir is the directory the Allure results are zipped under, the
+// one `allure generate` reads by default.
+const allureResultsDir = "allure-results/"
+
+type allureResult struct {
+	UUID          string               `json:"uuid"`
+	HistoryID     string               `json:"historyId"`
+	TestCaseID    string               `json:"testCaseId"`
+	Name          string               `json:"name"`
+	FullName      string               `json:"fullName"`
+	Description   string               `json:"description,omitempty"`
+	Status        string               `json:"status"`
+	StatusDetails *allureStatusDetails `json:"statusDetails,omitempty"`
+	Stage         string               `json:"stage"`
+	Start         int64                `json:"start"`
+	Stop          int64                `json:"stop"`
+	Labels        []allureLabel        `json:"labels"`
+	Parameters    []allureParameter    `json:"parameters,omitempty"`
+	Steps         []*allureStep        `json:"steps"`
+	Attachments   []allureAttachment   `json:"attachments"`
+}
+
+type allureStatusDetails struct {
+	Message string `json:"message,omitempty"`
+	Flaky   bool   `json:"flaky,omitempty"`
+	Muted   bool   `json:"muted,omitempty"`
+}
+
+type allureStep struct {
+	Name          string               `json:"name"`
+	Status        string               `json:"status"`
+	StatusDetails *allureStatusDetails `json:"statusDetails,omitempty"`
+	Stage         string               `json:"stage"`
+	Start         int64                `json:"start"`
+	Stop          int64                `json:"stop"`
+	Attachments   []allureAttachment   `json:"attachments"`
+}
+
+type allureLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type allureParameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type allureAttachment struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+// RenderAllureResults zips a report as an Allure results directory. Every
+// attempt is a result of its own sharing the test case's history, so Allure
+// shows earlier attempts as retries. Steps come from the execution logs and
+// screenshots are attached to the step they were taken at.
+func RenderAllureResults(export *ReportExport) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, execution := range export.Executions {
+		if err := writeAllureResult(archive, export, execution); err != nil {
+			return nil, err
+		}
+	}
+
+	properties := fmt.Sprintf("Project=%s\nReport=%s\nGenerated=%s\n",
+		export.Report.Project.Name, export.Report.Name, export.GeneratedAt.Format("2006-01-02 15:04:05"))
+	if export.Report.TestSuiteID != nil {
+		properties += fmt.Sprintf("TestSuite=%s\n", export.Report.TestSuite.Name)
+	}
+	if err := writeZipFile(archive, allureResultsDir+"environment.properties", []byte(properties)); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeAllureResult(archive *zip.Writer, export *ReportExport, execution ExportedExecution) error {
+	report := export.Report
+	suiteName := report.Name
+	if report.TestSuiteID != nil && report.TestSuite.Name != "" {
+		suiteName = report.TestSuite.Name
+	}
+	name := execution.TestCase.Name
+	if name == "" {
+		name = fmt.Sprintf("test-case-%d", execution.TestCaseID)
+	}
+
+	status := allureStatus(execution.Status, execution.ErrorClass)
+	start := execution.StartTime
+	stop := start.Add(executionElapsed(execution.TestExecution))
+
+	result := allureResult{
+		UUID:        newUUID(),
+		HistoryID:   md5Hex(fmt.Sprintf("test-case-%d", execution.TestCaseID)),
+		TestCaseID:  md5Hex(fmt.Sprintf("test-case-%d", execution.TestCaseID)),
+		Name:        name,
+		FullName:    fmt.Sprintf("%s.%s", suiteName, name),
+		Description: execution.TestCase.Description,
+		Status:      status,
+		Stage:       "finished",
+		Start:       start.UnixMilli(),
+		Stop:        stop.UnixMilli(),
+		Labels: []allureLabel{
+			{Name: "parentSuite", Value: report.Project.Name},
+			{Name: "suite", Value: suiteName},
+			{Name: "severity", Value: allureSeverity(execution.TestCase.Priority)},
+			{Name: "framework", Value: "autoui-platform"},
+		},
+		Parameters: []allureParameter{
+			{Name: "attempt", Value: fmt.Sprint(execution.Attempt)},
+		},
+		Steps:       []*allureStep{},
+		Attachments: []allureAttachment{},
+	}
+	for _, tag := range strings.Split(execution.TestCase.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result.Labels = append(result.Labels, allureLabel{Name: "tag", Value: tag})
+		}
+	}
+
+	details := &allureStatusDetails{
+		Message: execution.ErrorMessage,
+		Flaky:   (execution.Status == "passed" && execution.Attempt > 1) || execution.TestCase.IsFlaky,
+		Muted:   execution.Quarantined,
+	}
+	if *details != (allureStatusDetails{}) {
+		result.StatusDetails = details
+	}
+
+	steps, stepsByIndex := allureSteps(execution.Logs, status)
+	result.Steps = append(result.Steps, steps...)
+
+	for _, screenshot := range execution.Screenshots {
+		data, err := os.ReadFile(screenshot.Path)
+		if err != nil {
+			continue
+		}
+		attachment := allureAttachment{Name: screenshot.Name, Source: newUUID() + "-attachment.png", Type: "image/png"}
+		if err := writeZipFile(archive, allureResultsDir+attachment.Source, data); err != nil {
+			return err
+		}
+		if step, ok := stepsByIndex[screenshot.StepIndex]; ok {
+			step.Attachments = append(step.Attachments, attachment)
+		} else {
+			result.Attachments = append(result.Attachments, attachment)
+		}
+	}
+
+	if len(execution.Logs) > 0 {
+		attachment := allureAttachment{Name: "执行日志", Source: newUUID() + "-attachment.txt", Type: "text/plain"}
+		if err := writeZipFile(archive, allureResultsDir+attachment.Source, []byte(formatExecutionLogs(execution.Logs))); err != nil {
+			return err
+		}
+		result.Attachments = append(result.Attachments, attachment)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeZipFile(archive, allureResultsDir+result.UUID+"-result.json", data)
+}
+
+// allureSteps groups the logs of test steps into Allure steps by step index,
+// in the order they ran. A step with an error logged takes the status of
+// the failed test.
+func allureSteps(logs []executor.ExecutionLog, testStatus string) ([]*allureStep, map[int]*allureStep) {
+	var steps []*allureStep
+	byIndex := make(map[int]*allureStep)
+	for _, entry := range logs {
+		if entry.StepIndex < 0 {
+			continue
+		}
+		step, ok := byIndex[entry.StepIndex]
+		if !ok {
+			step = &allureStep{
+				Name:        entry.Message,
+				Status:      "passed",
+				Stage:       "finished",
+				Start:       entry.Timestamp.UnixMilli(),
+				Attachments: []allureAttachment{},
+			}
+			byIndex[entry.StepIndex] = step
+			steps = append(steps, step)
+		}
+		step.Stop = entry.Timestamp.UnixMilli()
+		if entry.Level == "error" {
+			step.Status = testStatus
+			if step.Status == "passed" {
+				step.Status = "broken"
+			}
+			step.StatusDetails = &allureStatusDetails{Message: entry.Message}
+		}
+	}
+	return steps, byIndex
+}
+
+// allureStatus maps an execution status to Allure's: failed assertions are
+// failures, every other failure is broken.
+func allureStatus(status, errorClass string) string {
+	switch status {
+	case "passed":
+		return "passed"
+	case "failed":
+		if errorClass == executor.ErrorClassAssertion {
+			return "failed"
+		}
+		return "broken"
+	case "interrupted":
+		return "broken"
+	}
+	return "skipped"
+}
+
+func allureSeverity(priority int) string {
+	switch priority {
+	case 1:
+		return "minor"
+	case 3:
+		return "critical"
+	}
+	return "normal"
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
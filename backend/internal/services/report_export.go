@@ -0,0 +1,247 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// screenshotDir is where executions and agents store their screenshots.
+const screenshotDir = "./screenshots"
+
+//go:embed templates/report.html
+var reportHTMLTemplate string
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"statusText":  statusText,
+	"formatTime":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"passRate":    passRate,
+	"inc":         func(i int) int { return i + 1 },
+	"formatFloat": func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) },
+}).Parse(reportHTMLTemplate))
+
+// ReportExport is a report with everything needed to export it: each
+// execution with its logs, screenshots and performance metrics.
+type ReportExport struct {
+	Report      models.TestReport
+	Executions  []ExportedExecution
+	GeneratedAt time.Time
+}
+
+type ExportedExecution struct {
+	models.TestExecution
+	Logs        []executor.ExecutionLog
+	Screenshots []ExportedScreenshot
+	Metrics     *models.PerformanceMetric
+}
+
+type ExportedScreenshot struct {
+	Name      string
+	Kind      string // initial, step, error or final
+	StepIndex int    // -1 unless taken at a step
+	Path      string
+}
+
+// LoadReportExport loads a report and its executions, oldest first, for
+// exporting.
+func LoadReportExport(reportID uint) (*ReportExport, error) {
+	var report models.TestReport
+	err := database.DB.Preload("Project").Preload("TestSuite").Preload("User").
+		Preload("Executions", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Executions.TestCase").
+		First(&report, reportID).Error
+	if err != nil {
+		return nil, err
+	}
+	report.User.Password = ""
+
+	return newReportExport(report), nil
+}
+
+// LoadSuiteRunExport loads a suite run for exporting, as a report of its
+// executions.
+func LoadSuiteRunExport(suiteRunID uint) (*ReportExport, error) {
+	var run models.SuiteRun
+	err := database.DB.Preload("TestSuite").Preload("TestSuite.Project").Preload("User").
+		Preload("Executions", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		Preload("Executions.TestCase").
+		First(&run, suiteRunID).Error
+	if err != nil {
+		return nil, err
+	}
+	run.User.Password = ""
+
+	report := models.TestReport{
+		Name:        fmt.Sprintf("%s - 套件执行 #%d", run.TestSuite.Name, run.ID),
+		ProjectID:   run.ProjectID,
+		Project:     run.TestSuite.Project,
+		TestSuiteID: &run.TestSuiteID,
+		TestSuite:   run.TestSuite,
+		SuiteRunID:  &run.ID,
+		Executions:  run.Executions,
+		UserID:      run.UserID,
+		User:        run.User,
+	}
+	AggregateExecutions(&report, run.Executions)
+
+	return newReportExport(report), nil
+}
+
+func newReportExport(report models.TestReport) *ReportExport {
+	export := &ReportExport{Report: report, GeneratedAt: time.Now()}
+	for _, execution := range report.Executions {
+		export.Executions = append(export.Executions, loadExportedExecution(execution))
+	}
+	return export
+}
+
+func loadExportedExecution(execution models.TestExecution) ExportedExecution {
+	exported := ExportedExecution{TestExecution: execution}
+
+	if execution.ExecutionLogs != "" {
+		json.Unmarshal([]byte(execution.ExecutionLogs), &exported.Logs)
+	}
+
+	// Screenshots are listed on the execution and, for older ones, as records
+	seen := make(map[string]bool)
+	var names []string
+	if execution.Screenshots != "" {
+		json.Unmarshal([]byte(execution.Screenshots), &names)
+	}
+	var records []models.Screenshot
+	database.DB.Where("execution_id = ?", execution.ID).Order("step_index ASC").Find(&records)
+	for _, record := range records {
+		names = append(names, record.FileName)
+	}
+	for _, name := range names {
+		name = filepath.Base(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		kind, stepIndex := parseScreenshotName(name)
+		exported.Screenshots = append(exported.Screenshots, ExportedScreenshot{
+			Name:      name,
+			Kind:      kind,
+			StepIndex: stepIndex,
+			Path:      filepath.Join(screenshotDir, name),
+		})
+	}
+
+	var metrics models.PerformanceMetric
+	if err := database.DB.Where("execution_id = ?", execution.ID).Order("id DESC").First(&metrics).Error; err == nil {
+		exported.Metrics = &metrics
+	}
+	return exported
+}
+
+// executionElapsed is how long an execution ran, from its times when it has
+// ended as Duration is in whole seconds.
+func executionElapsed(execution models.TestExecution) time.Duration {
+	if execution.EndTime != nil && execution.EndTime.After(execution.StartTime) {
+		return execution.EndTime.Sub(execution.StartTime)
+	}
+	return time.Duration(execution.Duration) * time.Second
+}
+
+// parseScreenshotName reads the kind and step index from a screenshot file
+// name, <kind>_<date>_<time>_<step>_<random>.png, which agent uploads prefix
+// with the execution ID.
+func parseScreenshotName(name string) (string, int) {
+	parts := strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+	if len(parts) < 5 {
+		return "", -1
+	}
+	parts = parts[len(parts)-5:]
+	kind := parts[0]
+	if kind != "step" && kind != "error" {
+		return kind, -1
+	}
+	index, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return kind, -1
+	}
+	return kind, index
+}
+
+// htmlScreenshot is a screenshot embedded into the HTML report.
+type htmlScreenshot struct {
+	ExportedScreenshot
+	DataURI template.URL
+}
+
+type htmlExecution struct {
+	ExportedExecution
+	Screenshots []htmlScreenshot
+}
+
+// RenderHTMLReport renders a report as a single HTML file that needs nothing
+// else to be viewed, screenshots are embedded.
+func RenderHTMLReport(export *ReportExport) ([]byte, error) {
+	executions := make([]htmlExecution, 0, len(export.Executions))
+	for _, execution := range export.Executions {
+		item := htmlExecution{ExportedExecution: execution}
+		for _, screenshot := range execution.Screenshots {
+			data, err := os.ReadFile(screenshot.Path)
+			if err != nil {
+				continue
+			}
+			item.Screenshots = append(item.Screenshots, htmlScreenshot{
+				ExportedScreenshot: screenshot,
+				DataURI:            template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data)),
+			})
+		}
+		executions = append(executions, item)
+	}
+
+	var buf bytes.Buffer
+	err := reportHTML.Execute(&buf, map[string]interface{}{
+		"Report":      export.Report,
+		"Executions":  executions,
+		"GeneratedAt": export.GeneratedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func statusText(status string) string {
+	switch status {
+	case "passed":
+		return "通过"
+	case "failed":
+		return "失败"
+	case "running":
+		return "运行中"
+	case "pending":
+		return "等待中"
+	case "cancelled":
+		return "已取消"
+	case "interrupted":
+		return "已中断"
+	case "completed":
+		return "已完成"
+	}
+	return status
+}
+
+func passRate(report models.TestReport) string {
+	if report.TotalCases == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(report.PassedCases)*100/float64(report.TotalCases))
+}
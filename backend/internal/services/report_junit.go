@@ -0,0 +1,224 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The JUnit XML written here follows the Surefire schema that Jenkins and
+// GitLab read: earlier failed attempts of a retried test case are listed as
+// flakyFailure when it passed in the end and as rerunFailure otherwise.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name          string         `xml:"name,attr"`
+	ClassName     string         `xml:"classname,attr"`
+	Time          string         `xml:"time,attr"`
+	Failure       *junitFailure  `xml:"failure,omitempty"`
+	Error         *junitFailure  `xml:"error,omitempty"`
+	Skipped       *junitSkipped  `xml:"skipped,omitempty"`
+	FlakyFailures []junitFailure `xml:"flakyFailure,omitempty"`
+	RerunFailures []junitFailure `xml:"rerunFailure,omitempty"`
+	SystemOut     *junitOutput   `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message   string       `xml:"message,attr"`
+	Type      string       `xml:"type,attr,omitempty"`
+	Text      string       `xml:",cdata"`
+	SystemOut *junitOutput `xml:"system-out,omitempty"`
+}
+
+// junitOutput is written as CDATA to keep logs readable.
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// RenderJUnitReport renders a report as JUnit XML, one testcase per test
+// case by its last attempt with the execution logs as system-out.
+func RenderJUnitReport(export *ReportExport) ([]byte, error) {
+	report := export.Report
+	className := report.Project.Name
+	if report.TestSuiteID != nil && report.TestSuite.Name != "" {
+		className = report.TestSuite.Name
+	}
+
+	suite := junitTestSuite{
+		Name:      report.Name,
+		Time:      junitSeconds(time.Duration(report.Duration) * time.Second),
+		Timestamp: report.StartTime.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "project", Value: report.Project.Name},
+		},
+	}
+	if report.TestSuiteID != nil {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "test_suite", Value: report.TestSuite.Name})
+	}
+	if report.SuiteRunID != nil {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "suite_run_id", Value: fmt.Sprint(*report.SuiteRunID)})
+	}
+
+	byID := make(map[uint]ExportedExecution, len(export.Executions))
+	for _, execution := range export.Executions {
+		byID[execution.ID] = execution
+	}
+
+	for _, execution := range export.Executions {
+		// Attempts that were retried are written with their retry
+		if execution.Retried {
+			continue
+		}
+
+		testCase := junitTestCase{
+			Name:      execution.TestCase.Name,
+			ClassName: className,
+			Time:      junitSeconds(executionElapsed(execution.TestExecution)),
+			SystemOut: junitOutputOf(execution.Logs),
+		}
+		if testCase.Name == "" {
+			testCase.Name = fmt.Sprintf("test-case-%d", execution.TestCaseID)
+		}
+
+		switch {
+		case execution.Status == "passed":
+		case execution.Status == "failed" && execution.Quarantined:
+			testCase.Skipped = &junitSkipped{Message: "已隔离用例失败: " + execution.ErrorMessage}
+			suite.Skipped++
+		case execution.Status == "failed":
+			testCase.Failure = junitFailureOf(execution, false)
+			suite.Failures++
+		case execution.Status == "interrupted":
+			testCase.Error = junitFailureOf(execution, false)
+			suite.Errors++
+		default:
+			testCase.Skipped = &junitSkipped{Message: statusText(execution.Status)}
+			suite.Skipped++
+		}
+
+		for _, attempt := range earlierAttempts(execution, byID) {
+			if attempt.Status != "failed" && attempt.Status != "interrupted" {
+				continue
+			}
+			failure := *junitFailureOf(attempt, true)
+			if execution.Status == "passed" {
+				testCase.FlakyFailures = append(testCase.FlakyFailures, failure)
+			} else {
+				testCase.RerunFailures = append(testCase.RerunFailures, failure)
+			}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+	}
+
+	suites := junitTestSuites{
+		Name:     report.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// earlierAttempts returns the attempts a final execution retried, first
+// attempt first.
+func earlierAttempts(execution ExportedExecution, byID map[uint]ExportedExecution) []ExportedExecution {
+	var attempts []ExportedExecution
+	for id := execution.RetryOfID; id != nil; {
+		attempt, ok := byID[*id]
+		if !ok {
+			break
+		}
+		attempts = append([]ExportedExecution{attempt}, attempts...)
+		id = attempt.RetryOfID
+	}
+	return attempts
+}
+
+func junitFailureOf(execution ExportedExecution, withLogs bool) *junitFailure {
+	failure := &junitFailure{
+		Message: execution.ErrorMessage,
+		Type:    execution.ErrorClass,
+		Text:    execution.ErrorMessage,
+	}
+	if failure.Message == "" {
+		failure.Message = statusText(execution.Status)
+	}
+	if withLogs {
+		failure.Message = fmt.Sprintf("第%d次执行: %s", execution.Attempt, failure.Message)
+		failure.SystemOut = junitOutputOf(execution.Logs)
+	}
+	return failure
+}
+
+func junitOutputOf(logs []executor.ExecutionLog) *junitOutput {
+	if len(logs) == 0 {
+		return nil
+	}
+	return &junitOutput{Text: formatExecutionLogs(logs)}
+}
+
+// formatExecutionLogs writes execution logs as plain text, one line each.
+func formatExecutionLogs(logs []executor.ExecutionLog) string {
+	var b strings.Builder
+	for _, entry := range logs {
+		fmt.Fprintf(&b, "[%s] %-5s ", entry.Timestamp.Format("2006-01-02 15:04:05.000"), strings.ToUpper(entry.Level))
+		if entry.StepIndex >= 0 {
+			fmt.Fprintf(&b, "step %d: ", entry.StepIndex+1)
+		}
+		b.WriteString(entry.Message)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
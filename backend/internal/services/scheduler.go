@@ -4,22 +4,42 @@ import (
 	"autoui-platform/backend/internal/executor"
 	"autoui-platform/backend/internal/models"
 	"autoui-platform/backend/pkg/database"
-	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
 )
 
+// cronParser parses schedules the same way the scheduler does: six fields
+// starting with seconds, or descriptors like @daily.
+var cronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Missed run policies decide what happens to runs missed while the backend
+// was down.
+const (
+	MissedRunSkip    = "skip"     // record the missed runs only
+	MissedRunRunOnce = "run_once" // run once on startup, however many were missed
+)
+
 type SchedulerService struct {
-	cron *cron.Cron
+	cron    *cron.Cron
+	entries map[uint]cron.EntryID // test suite ID -> cron entry
+	mutex   sync.Mutex
 }
 
 var GlobalScheduler *SchedulerService
 
-func InitScheduler() error {
+// InitScheduler schedules all suites and catches up on runs missed within
+// catchUpWindow while the backend was down.
+func InitScheduler(catchUpWindow time.Duration) error {
 	GlobalScheduler = &SchedulerService{
-		cron: cron.New(cron.WithSeconds()),
+		cron:    cron.New(cron.WithParser(cronParser)),
+		entries: make(map[uint]cron.EntryID),
 	}
 
 	// Load existing scheduled test suites
@@ -28,6 +48,9 @@ func InitScheduler() error {
 		return err
 	}
 
+	GlobalScheduler.recoverRunState()
+	GlobalScheduler.catchUpMissedRuns(time.Now(), catchUpWindow)
+
 	// Start the cron scheduler
 	GlobalScheduler.cron.Start()
 	log.Println("Scheduler service initialized")
@@ -35,10 +58,33 @@ func InitScheduler() error {
 	return nil
 }
 
+// ValidateSchedule reports whether expr can be scheduled in timezone. An
+// empty expression means the suite is only run manually.
+func ValidateSchedule(expr, timezone string) error {
+	if expr == "" {
+		return nil
+	}
+	if _, err := loadLocation(timezone); err != nil {
+		return err
+	}
+	if _, err := cronParser.Parse(scheduleSpec(expr, timezone)); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return nil
+}
+
+// scheduleSpec evaluates expr in timezone by prefixing it with CRON_TZ,
+// unless the expression already names its own timezone.
+func scheduleSpec(expr, timezone string) string {
+	if timezone == "" || strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		return expr
+	}
+	return "CRON_TZ=" + timezone + " " + expr
+}
+
 func (s *SchedulerService) loadScheduledTestSuites() error {
 	var testSuites []models.TestSuite
-	err := database.DB.Preload("TestCases", "status = ?", 1).
-		Where("schedule != '' AND schedule IS NOT NULL AND status = ?", 1).
+	err := database.DB.Where("cron_expression != '' AND cron_expression IS NOT NULL AND status = ?", 1).
 		Find(&testSuites).Error
 	if err != nil {
 		return err
@@ -55,33 +101,72 @@ func (s *SchedulerService) loadScheduledTestSuites() error {
 	return nil
 }
 
+// AddTestSuiteSchedule schedules testSuite by its cron expression, replacing
+// any previous schedule of the suite.
 func (s *SchedulerService) AddTestSuiteSchedule(testSuite models.TestSuite) error {
-	if testSuite.Schedule == "" {
+	s.RemoveTestSuiteSchedule(testSuite.ID)
+
+	if testSuite.CronExpression == "" || testSuite.SchedulePaused || testSuite.Status != 1 {
 		return nil
 	}
 
-	// Remove existing schedule if any
-	s.RemoveTestSuiteSchedule(testSuite.ID)
-
-	// Add new schedule
-	entryID, err := s.cron.AddFunc(testSuite.Schedule, func() {
-		s.executeScheduledTestSuite(testSuite.ID)
+	testSuiteID := testSuite.ID
+	entryID, err := s.cron.AddFunc(scheduleSpec(testSuite.CronExpression, testSuite.ScheduleTimezone), func() {
+		s.executeScheduledTestSuite(testSuiteID)
 	})
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Added schedule for test suite %d (entry %d): %s", testSuite.ID, entryID, testSuite.Schedule)
+	s.mutex.Lock()
+	s.entries[testSuiteID] = entryID
+	s.mutex.Unlock()
+
+	log.Printf("Added schedule for test suite %d (entry %d): %s", testSuiteID, entryID,
+		scheduleSpec(testSuite.CronExpression, testSuite.ScheduleTimezone))
 	return nil
 }
 
 func (s *SchedulerService) RemoveTestSuiteSchedule(testSuiteID uint) {
-	// In a real implementation, you would store the entry IDs mapped to test suite IDs
-	// For simplicity, we'll just log this action
-	log.Printf("Removing schedule for test suite %d", testSuiteID)
+	s.mutex.Lock()
+	entryID, exists := s.entries[testSuiteID]
+	delete(s.entries, testSuiteID)
+	s.mutex.Unlock()
+
+	if exists {
+		s.cron.Remove(entryID)
+		log.Printf("Removed schedule for test suite %d (entry %d)", testSuiteID, entryID)
+	}
+}
+
+// recordRun stores the outcome of a schedule trigger in the suite's run
+// history and logs it.
+func (s *SchedulerService) recordRun(testSuiteID uint, firedAt time.Time, status, reason string, executionCount int) {
+	run := models.ScheduleRun{
+		TestSuiteID:    testSuiteID,
+		FiredAt:        firedAt,
+		Status:         status,
+		Reason:         reason,
+		ExecutionCount: executionCount,
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		log.Printf("Failed to record schedule run of test suite %d: %v", testSuiteID, err)
+	}
+
+	if reason != "" {
+		log.Printf("Scheduled run of test suite %d %s: %s", testSuiteID, status, reason)
+	}
 }
 
 func (s *SchedulerService) executeScheduledTestSuite(testSuiteID uint) {
+	firedAt := time.Now()
+	database.DB.Model(&models.TestSuite{}).Where("id = ?", testSuiteID).Update("last_fired_at", firedAt)
+	s.fireTestSuite(testSuiteID, firedAt)
+}
+
+// fireTestSuite starts a scheduled run of a suite, unless a blackout window
+// or the overlap policy prevents it. firedAt is the time the run was due.
+func (s *SchedulerService) fireTestSuite(testSuiteID uint, firedAt time.Time) {
 	log.Printf("Executing scheduled test suite %d", testSuiteID)
 
 	// Load test suite with test cases
@@ -89,176 +174,193 @@ func (s *SchedulerService) executeScheduledTestSuite(testSuiteID uint) {
 	err := database.DB.Preload("TestCases", "status = ?", 1).
 		Where("id = ? AND status = ?", testSuiteID, 1).First(&testSuite).Error
 	if err != nil {
-		log.Printf("Failed to load test suite %d: %v", testSuiteID, err)
+		s.recordRun(testSuiteID, firedAt, "failed", fmt.Sprintf("failed to load test suite: %v", err), 0)
 		return
 	}
 
 	if len(testSuite.TestCases) == 0 {
-		log.Printf("Test suite %d has no test cases", testSuiteID)
+		s.recordRun(testSuiteID, firedAt, "skipped", "test suite has no test cases", 0)
 		return
 	}
 
-	// Check if executor is available
-	if executor.GlobalExecutor == nil {
-		log.Printf("Test executor not available for scheduled execution")
-		return
+	// Release windows and other blackouts must not see scheduled runs
+	blackouts, err := ProjectBlackouts(testSuite.ProjectID)
+	if err != nil {
+		log.Printf("Failed to load blackout windows for test suite %d: %v", testSuiteID, err)
 	}
-
-	runningCount := executor.GlobalExecutor.GetRunningCount()
-	if runningCount + len(testSuite.TestCases) > 10 {
-		log.Printf("Insufficient capacity for scheduled test suite %d (need %d, available %d)", 
-			testSuiteID, len(testSuite.TestCases), 10-runningCount)
+	if blackout := FindBlackout(blackouts, time.Now()); blackout != nil {
+		s.recordRun(testSuiteID, firedAt, "skipped", fmt.Sprintf("blackout window %q", blackout.Name), 0)
 		return
 	}
 
-	var executions []models.TestExecution
-
-	// Create execution records for all test cases
-	for _, testCase := range testSuite.TestCases {
-		execution := models.TestExecution{
-			TestCaseID:    testCase.ID,
-			TestSuiteID:   &testSuite.ID,
-			Status:        "pending",
-			StartTime:     time.Now(),
-			UserID:        testSuite.UserID, // Use test suite owner as executor
-			ErrorMessage:  "",
-			ExecutionLogs: "[]",
-			Screenshots:   "[]",
-		}
-
-		err = database.DB.Create(&execution).Error
-		if err != nil {
-			log.Printf("Failed to create execution record for test case %d: %v", testCase.ID, err)
-			continue
+	if IsSuiteRunning(testSuiteID) {
+		switch testSuite.OverlapPolicy {
+		case OverlapQueueOne:
+			// Only one run waits, later fires are dropped until it has started
+			result := database.DB.Model(&models.TestSuite{}).
+				Where("id = ? AND queued_run_at IS NULL", testSuiteID).
+				Update("queued_run_at", firedAt)
+			if result.RowsAffected == 0 {
+				s.recordRun(testSuiteID, firedAt, "skipped", "previous run still in progress and another run is already queued", 0)
+			} else {
+				s.recordRun(testSuiteID, firedAt, "queued", "previous run still in progress", 0)
+			}
+			return
+		case OverlapCancelPrevious:
+			cancelled := CancelSuiteRuns(testSuiteID)
+			log.Printf("Cancelled previous run of test suite %d (%d executions)", testSuiteID, cancelled)
+		default:
+			s.recordRun(testSuiteID, firedAt, "skipped", "previous run still in progress", 0)
+			return
 		}
-
-		executions = append(executions, execution)
 	}
 
-	// Execute all test cases asynchronously
-	go func() {
-		for i, execution := range executions {
-			execution.Status = "running"
-			database.DB.Save(&execution)
+	s.startScheduledRun(testSuite, firedAt)
+}
 
-			// Load test case with relations
-			var testCase models.TestCase
-			database.DB.Preload("Environment").Preload("Device").
-				First(&testCase, execution.TestCaseID)
+// startScheduledRun starts a run of a loaded test suite and records it in the
+// suite's schedule history.
+func (s *SchedulerService) startScheduledRun(testSuite models.TestSuite, firedAt time.Time) {
+	// Check if executor is available
+	if executor.GlobalExecutor == nil {
+		s.recordRun(testSuite.ID, firedAt, "failed", "test executor not available", 0)
+		return
+	}
 
-			resultChan := executor.GlobalExecutor.ExecuteTestCase(&execution, &testCase)
-			result := <-resultChan
+	run, err := StartSuiteRun(testSuite, SuiteRunOptions{
+		UserID:     testSuite.UserID, // Use test suite owner as executor
+		Trigger:    TriggerSchedule,
+	})
+	if err != nil {
+		s.recordRun(testSuite.ID, firedAt, "failed", err.Error(), 0)
+		return
+	}
 
-			// Update execution with result
-			if result.Success {
-				execution.Status = "passed"
-			} else {
-				execution.Status = "failed"
-				execution.ErrorMessage = result.ErrorMessage
-			}
+	s.recordRun(testSuite.ID, firedAt, "started", "", len(run.Executions))
+	log.Printf("Started scheduled suite run %d for test suite %d with %d test cases", run.ID, testSuite.ID, len(run.Executions))
+}
 
-			now := time.Now()
-			execution.EndTime = &now
-			execution.Duration = int(now.Sub(execution.StartTime).Seconds())
+// startQueuedRun starts the run queued by the queue_one overlap policy once
+// the suite is idle.
+func (s *SchedulerService) startQueuedRun(testSuiteID uint) {
+	var testSuite models.TestSuite
+	err := database.DB.Preload("TestCases", "status = ?", 1).
+		Where("id = ? AND queued_run_at IS NOT NULL", testSuiteID).First(&testSuite).Error
+	if err != nil {
+		return
+	}
 
-			// Save logs and screenshots
-			if logsJSON, err := json.Marshal(result.Logs); err == nil {
-				execution.ExecutionLogs = string(logsJSON)
-			}
-			if screenshotsJSON, err := json.Marshal(result.Screenshots); err == nil {
-				execution.Screenshots = string(screenshotsJSON)
-			}
+	firedAt := *testSuite.QueuedRunAt
+	database.DB.Model(&testSuite).Update("queued_run_at", nil)
 
-			database.DB.Save(&execution)
+	if testSuite.Status != 1 || len(testSuite.TestCases) == 0 {
+		s.recordRun(testSuiteID, firedAt, "skipped", "queued run dropped, test suite was deleted or emptied", 0)
+		return
+	}
+	s.startScheduledRun(testSuite, firedAt)
+}
 
-			// Save performance metrics if available
-			if result.Metrics != nil {
-				result.Metrics.ExecutionID = execution.ID
-				database.DB.Create(result.Metrics)
-			}
+// catchUpMissedRuns looks for schedule fires between each suite's last fire
+// and now, which were missed while the backend was down. Depending on the
+// suite's policy the latest one is run once now or only recorded. Missed runs
+// older than window, or all of them if window is zero, are never run.
+func (s *SchedulerService) catchUpMissedRuns(now time.Time, window time.Duration) {
+	var testSuites []models.TestSuite
+	err := database.DB.Where("cron_expression != '' AND schedule_paused = ? AND last_fired_at IS NOT NULL AND status = ?", false, 1).
+		Find(&testSuites).Error
+	if err != nil {
+		log.Printf("Failed to load test suites for missed run catch-up: %v", err)
+		return
+	}
 
-			executions[i] = execution
+	for _, testSuite := range testSuites {
+		schedule, err := cronParser.Parse(scheduleSpec(testSuite.CronExpression, testSuite.ScheduleTimezone))
+		if err != nil {
+			continue
 		}
 
-		// Create test report for scheduled execution
-		s.createScheduledTestReport(testSuite, executions)
-	}()
-
-	log.Printf("Started scheduled execution for test suite %d with %d test cases", testSuiteID, len(executions))
-}
-
-func (s *SchedulerService) createScheduledTestReport(testSuite models.TestSuite, executions []models.TestExecution) {
-	// Calculate statistics
-	var totalCases, passedCases, failedCases, errorCases int
-	var minStartTime, maxEndTime time.Time
-	var totalDuration int
-
-	for i, execution := range executions {
-		totalCases++
-		
-		switch execution.Status {
-		case "passed":
-			passedCases++
-		case "failed":
-			failedCases++
-		case "error":
-			errorCases++
+		var missed int
+		var lastMissed time.Time
+		for next := schedule.Next(*testSuite.LastFiredAt); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+			missed++
+			lastMissed = next
 		}
-
-		if i == 0 || execution.StartTime.Before(minStartTime) {
-			minStartTime = execution.StartTime
+		if missed == 0 {
+			continue
 		}
 
-		if execution.EndTime != nil {
-			if i == 0 || execution.EndTime.After(maxEndTime) {
-				maxEndTime = *execution.EndTime
-			}
+		// Missed fires are only considered once
+		database.DB.Model(&testSuite).Update("last_fired_at", lastMissed)
+
+		reason := fmt.Sprintf("missed %d runs while the backend was down, last due at %s",
+			missed, lastMissed.Format("2006-01-02 15:04:05"))
+		switch {
+		case testSuite.MissedRunPolicy != MissedRunRunOnce:
+			s.recordRun(testSuite.ID, lastMissed, "missed", reason+", policy is to skip", 0)
+		case window <= 0 || now.Sub(lastMissed) > window:
+			s.recordRun(testSuite.ID, lastMissed, "missed", reason+", outside the catch-up window", 0)
+		default:
+			s.recordRun(testSuite.ID, lastMissed, "missed", reason+", catching up once", 0)
+			go s.fireTestSuite(testSuite.ID, lastMissed)
 		}
-
-		totalDuration += execution.Duration
 	}
+}
 
-	// Set default end time if no executions have end time
-	if maxEndTime.IsZero() {
-		maxEndTime = time.Now()
+// recoverRunState resets suites left running by a previous process, whose
+// runs ended with it, and starts the runs that were queued behind them.
+func (s *SchedulerService) recoverRunState() {
+	result := database.DB.Model(&models.TestSuite{}).Where("run_state = ?", "running").
+		Updates(map[string]interface{}{"run_state": "idle", "run_started_at": nil})
+	if result.RowsAffected > 0 {
+		log.Printf("Reset run state of %d test suites interrupted by restart", result.RowsAffected)
 	}
 
-	// Calculate total duration
-	reportDuration := int(maxEndTime.Sub(minStartTime).Seconds())
-	if reportDuration <= 0 {
-		reportDuration = totalDuration
-	}
+	// Suite runs with executions left are continued and marked running again;
+	// their queued runs start once they finish
+	resumed := resumeSuiteRuns()
 
-	// Create report
-	reportName := testSuite.Name + " - 定时执行 " + time.Now().Format("2006-01-02 15:04:05")
-	report := models.TestReport{
-		Name:        reportName,
-		ProjectID:   testSuite.ProjectID,
-		TestSuiteID: &testSuite.ID,
-		TotalCases:  totalCases,
-		PassedCases: passedCases,
-		FailedCases: failedCases,
-		ErrorCases:  errorCases,
-		StartTime:   minStartTime,
-		EndTime:     maxEndTime,
-		Duration:    reportDuration,
-		Status:      "completed",
-		UserID:      testSuite.UserID,
+	var testSuites []models.TestSuite
+	database.DB.Where("queued_run_at IS NOT NULL").Find(&testSuites)
+	for _, testSuite := range testSuites {
+		if !resumed[testSuite.ID] {
+			s.startQueuedRun(testSuite.ID)
+		}
 	}
+}
 
-	err := database.DB.Create(&report).Error
+// SetPaused pauses or resumes the schedule of a test suite. A paused suite
+// keeps its cron expression but doesn't fire until resumed.
+func (s *SchedulerService) SetPaused(testSuite *models.TestSuite, paused bool) error {
+	testSuite.SchedulePaused = paused
+	err := database.DB.Model(testSuite).Update("schedule_paused", paused).Error
 	if err != nil {
-		log.Printf("Failed to create scheduled test report: %v", err)
-		return
+		return err
+	}
+	if !paused {
+		// Fires during the pause were not missed
+		resetLastFired(testSuite)
 	}
+	return s.AddTestSuiteSchedule(*testSuite)
+}
 
-	// Associate executions with report
-	err = database.DB.Model(&report).Association("Executions").Replace(executions)
+// NextFireTimes returns the next count times expr fires in timezone after
+// from.
+func NextFireTimes(expr, timezone string, from time.Time, count int) ([]time.Time, error) {
+	schedule, err := cronParser.Parse(scheduleSpec(expr, timezone))
 	if err != nil {
-		log.Printf("Failed to associate executions with report: %v", err)
+		return nil, err
 	}
 
-	log.Printf("Created scheduled test report %d for test suite %d", report.ID, testSuite.ID)
+	times := make([]time.Time, 0, count)
+	next := from
+	for i := 0; i < count; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		times = append(times, next)
+	}
+	return times, nil
 }
 
 func (s *SchedulerService) Stop() {
@@ -274,6 +376,7 @@ func AddSchedule(testSuite models.TestSuite) error {
 	if GlobalScheduler == nil {
 		return nil
 	}
+	resetLastFired(&testSuite)
 	return GlobalScheduler.AddTestSuiteSchedule(testSuite)
 }
 
@@ -284,18 +387,31 @@ func RemoveSchedule(testSuiteID uint) {
 	GlobalScheduler.RemoveTestSuiteSchedule(testSuiteID)
 }
 
-func UpdateSchedule(testSuite models.TestSuite) error {
+// UpdateSchedule reschedules an edited test suite. The last fire time is
+// kept unless timingChanged, so edits that don't touch the cron expression or
+// timezone can't make a run that already happened count as missed.
+func UpdateSchedule(testSuite models.TestSuite, timingChanged bool) error {
 	if GlobalScheduler == nil {
 		return nil
 	}
-	
-	// Remove old schedule
-	GlobalScheduler.RemoveTestSuiteSchedule(testSuite.ID)
-	
-	// Add new schedule if present
-	if testSuite.Schedule != "" {
-		return GlobalScheduler.AddTestSuiteSchedule(testSuite)
+	if timingChanged || testSuite.LastFiredAt == nil {
+		resetLastFired(&testSuite)
 	}
-	
-	return nil
-}
\ No newline at end of file
+	return GlobalScheduler.AddTestSuiteSchedule(testSuite)
+}
+
+// resetLastFired starts missed run detection from now, for schedules that
+// were just created, changed or resumed.
+func resetLastFired(testSuite *models.TestSuite) {
+	now := time.Now()
+	testSuite.LastFiredAt = &now
+	database.DB.Model(&models.TestSuite{}).Where("id = ?", testSuite.ID).Update("last_fired_at", now)
+}
+
+func SetSchedulePaused(testSuite *models.TestSuite, paused bool) error {
+	if GlobalScheduler == nil {
+		testSuite.SchedulePaused = paused
+		return database.DB.Model(testSuite).Update("schedule_paused", paused).Error
+	}
+	return GlobalScheduler.SetPaused(testSuite, paused)
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"autoui-platform/backend/internal/executor"
+	"autoui-platform/backend/internal/models"
+	"autoui-platform/backend/pkg/database"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Overlap policies decide what a schedule does when it fires while the suite
+// is still running.
+const (
+	OverlapSkip           = "skip"            // drop the new run
+	OverlapQueueOne       = "queue_one"       // run once more after the current run, further fires are dropped
+	OverlapCancelPrevious = "cancel_previous" // cancel the current run and start the new one
+)
+
+// Triggers a suite run is started by.
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerRerun    = "rerun" // rerun of the failed test cases of another run
+)
+
+// suiteRun is a run of a test suite in progress in this process.
+type suiteRun struct {
+	id        uint
+	cancelled bool
+}
+
+type SuiteRunOptions struct {
+	UserID   uint
+	IsVisual bool
+	Trigger  string // TriggerManual if empty
+	// TestCases restricts the run to these test cases of the suite, all of
+	// them if nil
+	TestCases []models.TestCase
+	RerunOfID *uint
+}
+
+var (
+	suiteRuns      = make(map[uint]map[*suiteRun]bool) // by test suite ID
+	suiteRunsMutex sync.Mutex
+)
+
+// StartSuiteRun creates a suite run with an execution record for every test
+// case of testSuite and runs them one after another in the background. The
+// returned run holds the created executions.
+func StartSuiteRun(testSuite models.TestSuite, options SuiteRunOptions) (*models.SuiteRun, error) {
+	if executor.GlobalExecutor == nil {
+		return nil, fmt.Errorf("test executor not available")
+	}
+
+	testCases := options.TestCases
+	if testCases == nil {
+		testCases = testSuite.TestCases
+	}
+	trigger := options.Trigger
+	if trigger == "" {
+		trigger = TriggerManual
+	}
+
+	now := time.Now()
+	run := models.SuiteRun{
+		TestSuiteID:   testSuite.ID,
+		ProjectID:     testSuite.ProjectID,
+		EnvironmentID: testSuite.EnvironmentID,
+		Trigger:       trigger,
+		Status:        "running",
+		RerunOfID:     options.RerunOfID,
+		IsVisual:      options.IsVisual,
+		TotalCases:    len(testCases),
+		StartTime:     now,
+		UserID:        options.UserID,
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create suite run: %w", err)
+	}
+
+	var executions []models.TestExecution
+	for _, testCase := range testCases {
+		execution := models.TestExecution{
+			TestCaseID:    testCase.ID,
+			TestSuiteID:   &testSuite.ID,
+			SuiteRunID:    &run.ID,
+			ExecutionType: "test_suite",
+			Status:        "pending",
+			Priority:      executionPriority(testSuite.Priority, testCase.Priority),
+			IsVisual:      options.IsVisual,
+			StartTime:     now,
+			UserID:        options.UserID,
+			ErrorMessage:  "",
+			ExecutionLogs: "[]",
+			Screenshots:   "[]",
+		}
+
+		if err := database.DB.Create(&execution).Error; err != nil {
+			// Don't leave a partial run behind
+			for _, created := range executions {
+				database.DB.Model(&created).Update("status", "cancelled")
+			}
+			completeSuiteRun(run.ID, true)
+			return nil, fmt.Errorf("failed to create execution record for test case %d: %w", testCase.ID, err)
+		}
+
+		executions = append(executions, execution)
+	}
+
+	// The caller gets its own copy, the background run updates these
+	running := make([]models.TestExecution, len(executions))
+	copy(running, executions)
+
+	active := registerSuiteRun(testSuite.ID, run.ID)
+	go func() {
+		runSuiteExecutions(active, running)
+		finishSuiteRun(testSuite.ID, active)
+	}()
+
+	run.Executions = executions
+	return &run, nil
+}
+
+// RerunFailedTestCases starts a new run of the test cases that failed or were
+// interrupted in a finished suite run.
+func RerunFailedTestCases(run *models.SuiteRun, userID uint) (*models.SuiteRun, error) {
+	var testCaseIDs []uint
+	err := database.DB.Model(&models.TestExecution{}).
+		Where("suite_run_id = ? AND retried = ? AND status IN ?", run.ID, false, []string{"failed", "interrupted"}).
+		Distinct().Pluck("test_case_id", &testCaseIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failed executions: %w", err)
+	}
+	if len(testCaseIDs) == 0 {
+		return nil, fmt.Errorf("no failed test cases to rerun")
+	}
+
+	var testSuite models.TestSuite
+	err = database.DB.Preload("TestCases", "id IN ? AND status = ?", testCaseIDs, 1).
+		Where("id = ? AND status = ?", run.TestSuiteID, 1).First(&testSuite).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load test suite: %w", err)
+	}
+	if len(testSuite.TestCases) == 0 {
+		return nil, fmt.Errorf("the failed test cases no longer exist")
+	}
+
+	return StartSuiteRun(testSuite, SuiteRunOptions{
+		UserID:    userID,
+		IsVisual:  run.IsVisual,
+		Trigger:   TriggerRerun,
+		TestCases: testSuite.TestCases,
+		RerunOfID: &run.ID,
+	})
+}
+
+// registerSuiteRun records a run of the suite in progress and marks the suite
+// running.
+func registerSuiteRun(testSuiteID, suiteRunID uint) *suiteRun {
+	run := &suiteRun{id: suiteRunID}
+	suiteRunsMutex.Lock()
+	if suiteRuns[testSuiteID] == nil {
+		suiteRuns[testSuiteID] = make(map[*suiteRun]bool)
+	}
+	suiteRuns[testSuiteID][run] = true
+	suiteRunsMutex.Unlock()
+
+	now := time.Now()
+	database.DB.Model(&models.TestSuite{}).Where("id = ?", testSuiteID).
+		Updates(map[string]interface{}{"run_state": "running", "run_started_at": &now})
+	return run
+}
+
+// runSuiteExecutions queues the executions of a run one after another, each
+// once the previous one has finished. Executions already queued or running,
+// as found when resuming a run, are waited for.
+func runSuiteExecutions(run *suiteRun, executions []models.TestExecution) {
+	for i := range executions {
+		execution := &executions[i]
+
+		var resultChan <-chan executor.ExecutionResult
+		switch {
+		case execution.Status == "running" || execution.QueuedAt != nil:
+			resultChan = executor.GlobalExecutor.Wait(execution.ID)
+		case isSuiteRunCancelled(run):
+			// Executions stopped before their turn are not queued
+			database.DB.Model(execution).Where("status = ?", "pending").Update("status", "cancelled")
+		default:
+			resultChan = executor.GlobalExecutor.Enqueue(execution)
+		}
+
+		executionID := execution.ID
+		if resultChan != nil {
+			if result := <-resultChan; result.ExecutionID != 0 {
+				executionID = result.ExecutionID
+			}
+		}
+
+		// Pick up the result saved by the worker, of the last attempt if retried
+		*execution = models.TestExecution{}
+		database.DB.First(execution, executionID)
+
+		updateSuiteRunCounters(run.id)
+	}
+}
+
+// updateSuiteRunCounters recounts the results of a suite run from the last
+// attempt of each of its executions.
+func updateSuiteRunCounters(suiteRunID uint) (models.SuiteRun, error) {
+	var run models.SuiteRun
+	if err := database.DB.First(&run, suiteRunID).Error; err != nil {
+		return run, err
+	}
+
+	var executions []models.TestExecution
+	database.DB.Select("id", "status", "attempt", "retried", "quarantined", "start_time", "end_time", "duration").
+		Where("suite_run_id = ?", suiteRunID).Find(&executions)
+
+	var stats models.TestReport
+	AggregateExecutions(&stats, executions)
+
+	run.PassedCases, run.FailedCases, run.ErrorCases = stats.PassedCases, stats.FailedCases, stats.ErrorCases
+	run.PassedOnRetryCases, run.QuarantinedCases = stats.PassedOnRetryCases, stats.QuarantinedCases
+	run.CancelledCases = 0
+	for _, execution := range executions {
+		if !execution.Retried && execution.Status == "cancelled" {
+			run.CancelledCases++
+		}
+	}
+
+	err := database.DB.Model(&run).Updates(map[string]interface{}{
+		"passed_cases":          run.PassedCases,
+		"failed_cases":          run.FailedCases,
+		"error_cases":           run.ErrorCases,
+		"cancelled_cases":       run.CancelledCases,
+		"passed_on_retry_cases": run.PassedOnRetryCases,
+		"quarantined_cases":     run.QuarantinedCases,
+	}).Error
+	return run, err
+}
+
+// completeSuiteRun stores the final counters and status of a suite run and
+// creates its report. Failures of quarantined test cases don't fail the run.
+func completeSuiteRun(suiteRunID uint, cancelled bool) {
+	run, err := updateSuiteRunCounters(suiteRunID)
+	if err != nil {
+		log.Printf("Failed to complete suite run %d: %v", suiteRunID, err)
+		return
+	}
+
+	status := "passed"
+	switch {
+	case cancelled:
+		status = "cancelled"
+	case run.FailedCases > 0 || run.ErrorCases > 0:
+		status = "failed"
+	}
+
+	now := time.Now()
+	database.DB.Model(&run).Updates(map[string]interface{}{
+		"status":   status,
+		"end_time": &now,
+		"duration": int(now.Sub(run.StartTime).Seconds()),
+	})
+	log.Printf("Suite run %d of test suite %d %s: %d passed, %d failed", run.ID, run.TestSuiteID, status,
+		run.PassedCases, run.FailedCases)
+
+	createSuiteRunReport(run)
+}
+
+// resumeSuiteRuns continues suite runs a previous process left unfinished.
+// Their remaining executions are run in order as usual. Single test case
+// executions that never made it into the queue are queued. It returns the
+// IDs of the resumed suites.
+func resumeSuiteRuns() map[uint]bool {
+	var executions []models.TestExecution
+	database.DB.Where("status IN ?", []string{"pending", "running"}).Order("id ASC").Find(&executions)
+
+	legacy := make(map[uint][]models.TestExecution)
+	for i := range executions {
+		execution := &executions[i]
+		switch {
+		case execution.TestSuiteID == nil:
+			if execution.Status == "pending" && execution.QueuedAt == nil {
+				executor.GlobalExecutor.Enqueue(execution)
+			}
+		case execution.SuiteRunID == nil:
+			legacy[*execution.TestSuiteID] = append(legacy[*execution.TestSuiteID], *execution)
+		}
+	}
+	adoptLegacyExecutions(legacy)
+
+	var runs []models.SuiteRun
+	database.DB.Where("status = ?", "running").Order("id ASC").Find(&runs)
+
+	resumed := make(map[uint]bool)
+	for _, run := range runs {
+		var remaining []models.TestExecution
+		database.DB.Where("suite_run_id = ? AND status IN ?", run.ID, []string{"pending", "running"}).
+			Order("id ASC").Find(&remaining)
+
+		// The previous process stopped right after the last execution
+		if len(remaining) == 0 {
+			completeSuiteRun(run.ID, false)
+			continue
+		}
+
+		testSuiteID := run.TestSuiteID
+		active := registerSuiteRun(testSuiteID, run.ID)
+		go func() {
+			runSuiteExecutions(active, remaining)
+			finishSuiteRun(testSuiteID, active)
+		}()
+
+		resumed[testSuiteID] = true
+		log.Printf("Resumed suite run %d of test suite %d with %d remaining executions", run.ID, testSuiteID, len(remaining))
+	}
+	return resumed
+}
+
+// adoptLegacyExecutions groups unfinished suite executions created before
+// suite runs existed into a run per suite, so they are resumed like any other
+// run.
+func adoptLegacyExecutions(bySuite map[uint][]models.TestExecution) {
+	for testSuiteID, executions := range bySuite {
+		var testSuite models.TestSuite
+		if err := database.DB.First(&testSuite, testSuiteID).Error; err != nil {
+			continue
+		}
+
+		run := models.SuiteRun{
+			TestSuiteID:   testSuiteID,
+			ProjectID:     testSuite.ProjectID,
+			EnvironmentID: testSuite.EnvironmentID,
+			Trigger:       TriggerManual,
+			Status:        "running",
+			IsVisual:      executions[0].IsVisual,
+			TotalCases:    len(executions),
+			StartTime:     executions[0].StartTime,
+			UserID:        executions[0].UserID,
+		}
+		if err := database.DB.Create(&run).Error; err != nil {
+			log.Printf("Failed to create suite run for unfinished executions of test suite %d: %v", testSuiteID, err)
+			continue
+		}
+
+		ids := make([]uint, len(executions))
+		for i, execution := range executions {
+			ids[i] = execution.ID
+		}
+		database.DB.Model(&models.TestExecution{}).Where("id IN ?", ids).Update("suite_run_id", run.ID)
+	}
+}
+
+// finishSuiteRun completes a run and unregisters it. Once no run of the suite
+// is left, the suite becomes idle and a queued scheduled run is started.
+func finishSuiteRun(testSuiteID uint, run *suiteRun) {
+	completeSuiteRun(run.id, isSuiteRunCancelled(run))
+
+	suiteRunsMutex.Lock()
+	delete(suiteRuns[testSuiteID], run)
+	idle := len(suiteRuns[testSuiteID]) == 0
+	if idle {
+		delete(suiteRuns, testSuiteID)
+	}
+	suiteRunsMutex.Unlock()
+
+	if !idle {
+		return
+	}
+
+	database.DB.Model(&models.TestSuite{}).Where("id = ?", testSuiteID).
+		Updates(map[string]interface{}{"run_state": "idle", "run_started_at": nil})
+
+	if GlobalScheduler != nil {
+		GlobalScheduler.startQueuedRun(testSuiteID)
+	}
+}
+
+// IsSuiteRunning reports whether a run of the suite is in progress.
+func IsSuiteRunning(testSuiteID uint) bool {
+	suiteRunsMutex.Lock()
+	defer suiteRunsMutex.Unlock()
+	return len(suiteRuns[testSuiteID]) > 0
+}
+
+// CancelSuiteRun cancels a suite run in progress: its pending executions are
+// not started and running ones have their browser closed. It returns the
+// number of executions cancelled.
+func CancelSuiteRun(suiteRunID uint) int {
+	inProcess := false
+	suiteRunsMutex.Lock()
+	for _, runs := range suiteRuns {
+		for run := range runs {
+			if run.id == suiteRunID {
+				run.cancelled = true
+				inProcess = true
+			}
+		}
+	}
+	suiteRunsMutex.Unlock()
+
+	var executions []models.TestExecution
+	database.DB.Where("suite_run_id = ? AND status IN ?", suiteRunID, []string{"running", "pending"}).
+		Find(&executions)
+
+	for _, execution := range executions {
+		database.DB.Model(&execution).Update("status", "cancelled")
+		if executor.GlobalExecutor != nil {
+			executor.GlobalExecutor.CancelExecution(execution.ID)
+		}
+	}
+
+	// Nothing here runs it, complete it right away
+	if !inProcess {
+		completeSuiteRun(suiteRunID, true)
+	}
+
+	if len(executions) > 0 {
+		log.Printf("Cancelled %d executions of suite run %d", len(executions), suiteRunID)
+	}
+	return len(executions)
+}
+
+// CancelSuiteRuns cancels every run of the suite in progress. It returns the
+// number of executions cancelled.
+func CancelSuiteRuns(testSuiteID uint) int {
+	var runIDs []uint
+	database.DB.Model(&models.SuiteRun{}).Where("test_suite_id = ? AND status = ?", testSuiteID, "running").
+		Pluck("id", &runIDs)
+
+	cancelled := 0
+	for _, runID := range runIDs {
+		cancelled += CancelSuiteRun(runID)
+	}
+	return cancelled
+}
+
+func isSuiteRunCancelled(run *suiteRun) bool {
+	suiteRunsMutex.Lock()
+	defer suiteRunsMutex.Unlock()
+	return run.cancelled
+}
@@ -55,6 +55,11 @@ func AutoMigrate() error {
 		&models.TestReport{},
 		&models.PerformanceMetric{},
 		&models.Screenshot{},
+		&models.TestCaseFile{},
+		&models.ScheduleRun{},
+		&models.ScheduleBlackout{},
+		&models.Agent{},
+		&models.SuiteRun{},
 	)
 	
 	if err != nil {
@@ -62,10 +67,37 @@ func AutoMigrate() error {
 	}
 	
 	log.Println("Database migration completed")
+
+	if err := migrateLegacySchedules(); err != nil {
+		return err
+	}
 	
 	return SeedDefaultData()
 }
 
+// migrateLegacySchedules moves cron expressions from the old schedule column
+// into cron_expression, which is the only one the scheduler reads.
+func migrateLegacySchedules() error {
+	result := DB.Model(&models.TestSuite{}).
+		Where("schedule != '' AND schedule IS NOT NULL").
+		Where("cron_expression = '' OR cron_expression IS NULL").
+		Update("cron_expression", gorm.Expr("schedule"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to migrate test suite schedules: %w", result.Error)
+	}
+
+	// Clear the old column so a schedule removed later isn't migrated again
+	err := DB.Model(&models.TestSuite{}).Where("schedule != ''").Update("schedule", "").Error
+	if err != nil {
+		return fmt.Errorf("failed to clear legacy test suite schedules: %w", err)
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Migrated %d legacy test suite schedules", result.RowsAffected)
+	}
+	return nil
+}
+
 func SeedDefaultData() error {
 	// Seed default devices
 	devices := []models.Device{
@@ -132,6 +132,7 @@ const Executions: React.FC = () => {
       running: 'blue',
       pending: 'orange',
       cancelled: 'gray',
+      interrupted: 'volcano',
     };
     return colors[status] || 'default';
   };
@@ -143,6 +144,7 @@ const Executions: React.FC = () => {
       running: '运行中',
       pending: '等待中',
       cancelled: '已取消',
+      interrupted: '已中断',
     };
     return texts[status] || status;
   };
@@ -213,10 +215,19 @@ const Executions: React.FC = () => {
       dataIndex: 'status',
       key: 'status',
       width: 100,
-      render: (status: string) => (
-        <Tag color={getStatusColor(status)}>
-          {getStatusText(status)}
-        </Tag>
+      render: (status: string, record) => (
+        <>
+          <Tag color={getStatusColor(status)}>
+            {getStatusText(status)}
+            {status === 'pending' && record.queue_position > 0 && ` #${record.queue_position}`}
+          </Tag>
+          {record.attempt > 1 && (
+            <Tag color={status === 'passed' ? 'gold' : 'default'}>
+              {status === 'passed' ? '重试通过' : `第${record.attempt}次`}
+            </Tag>
+          )}
+          {record.retried && <Tag>已重试</Tag>}
+        </>
       ),
       filters: [
         { text: '成功', value: 'success' },
@@ -224,6 +235,7 @@ const Executions: React.FC = () => {
         { text: '运行中', value: 'running' },
         { text: '等待中', value: 'pending' },
         { text: '已取消', value: 'cancelled' },
+        { text: '已中断', value: 'interrupted' },
       ],
       onFilter: (value, record) => record.status === value,
     },
@@ -424,6 +436,7 @@ const Executions: React.FC = () => {
               <Option value="running">运行中</Option>
               <Option value="pending">等待中</Option>
               <Option value="cancelled">已取消</Option>
+              <Option value="interrupted">已中断</Option>
             </Select>
             
             <RangePicker
@@ -1,4 +1,4 @@
-import React, { useEffect, useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
 import {
   Card,
   Form,
@@ -14,6 +14,7 @@ import {
   Divider,
   List,
   Tag,
+  Switch,
 } from 'antd';
 import {
   PlayCircleOutlined,
@@ -22,12 +23,45 @@ import {
   MonitorOutlined,
 } from '@ant-design/icons';
 import { api } from '../../services/api';
+import { getToken } from '../../utils/auth';
 import type { Project, Environment, Device, TestStep } from '../../types';
 
 const { Title, Text } = Typography;
 const { TextArea } = Input;
 const { Step } = Steps;
 
+// Screencast frame of a headless session, see recorder.FrameData
+interface ScreencastFrame {
+  data: string;
+  metadata?: {
+    deviceWidth: number;
+    deviceHeight: number;
+  };
+}
+
+// Input event relayed to the headless browser, see recorder.InputEvent
+interface RemoteInput {
+  type: string;
+  x?: number;
+  y?: number;
+  button?: string;
+  click_count?: number;
+  delta_x?: number;
+  delta_y?: number;
+  modifiers: number;
+  key?: string;
+  code?: string;
+  text?: string;
+  key_code?: number;
+}
+
+const mouseButtons = ['left', 'middle', 'right'];
+// Mouse moves are relayed at most this often
+const mouseMoveInterval = 50;
+
+const inputModifiers = (event: React.MouseEvent | React.KeyboardEvent | React.WheelEvent) =>
+  (event.altKey ? 1 : 0) | (event.ctrlKey ? 2 : 0) | (event.metaKey ? 4 : 0) | (event.shiftKey ? 8 : 0);
+
 const Recording: React.FC = () => {
   const [current, setCurrent] = useState(0);
   const [form] = Form.useForm();
@@ -37,6 +71,11 @@ const Recording: React.FC = () => {
   const [sessionId, setSessionId] = useState<string>('');
   const [recordedSteps, setRecordedSteps] = useState<TestStep[]>([]);
   const [ws, setWs] = useState<WebSocket | null>(null);
+  const [headless, setHeadless] = useState(false);
+  const canvasRef = useRef<HTMLCanvasElement>(null);
+  // Page size in CSS pixels of the last frame, input coordinates are scaled to it
+  const frameSizeRef = useRef<{ width: number; height: number } | null>(null);
+  const lastMouseMoveRef = useRef(0);
 
   // Data states
   const [projects, setProjects] = useState<Project[]>([]);
@@ -80,21 +119,40 @@ const Recording: React.FC = () => {
       const response = await api.startRecording({
         target_url: values.target_url,
         device_id: values.device_id,
+        headless: !!values.headless,
       });
 
       setSessionId(response.session_id);
+      setHeadless(response.headless);
+      frameSizeRef.current = null;
       setIsRecording(true);
       setCurrent(1);
 
       // Establish WebSocket connection for real-time updates
       const wsUrl = `ws://localhost:8080/api/v1/ws/recording?session_id=${response.session_id}`;
-      const websocket = new WebSocket(wsUrl);
+      const websocket = new WebSocket(wsUrl, ['access_token', getToken() || '']);
       
       websocket.onmessage = (event) => {
         try {
-          const step = JSON.parse(event.data);
-          if (step && typeof step === 'object') {
-            setRecordedSteps(prev => (prev || []).concat([step]));
+          const msg = JSON.parse(event.data);
+          switch (msg?.type) {
+            case 'step_added':
+            case 'step_updated':
+              setRecordedSteps(prev => {
+                const steps = [...(prev || [])];
+                steps[msg.data.index] = msg.data.step;
+                return steps;
+              });
+              break;
+            case 'steps':
+              setRecordedSteps(msg.data.steps || []);
+              break;
+            case 'frame':
+              drawFrame(msg.data);
+              break;
+            case 'error':
+              message.error(msg.data.message);
+              break;
           }
         } catch (error) {
           console.error('Failed to parse WebSocket message:', error);
@@ -107,7 +165,7 @@ const Recording: React.FC = () => {
       };
 
       setWs(websocket);
-      message.success('录制已开始，请在浏览器中执行操作');
+      message.success(response.headless ? '录制已开始，请在下方画面中执行操作' : '录制已开始，请在浏览器中执行操作');
     } catch (error) {
       console.error('Failed to start recording:', error);
     } finally {
@@ -115,6 +173,86 @@ const Recording: React.FC = () => {
     }
   };
 
+  const drawFrame = (frame: ScreencastFrame) => {
+    const image = new Image();
+    image.onload = () => {
+      const canvas = canvasRef.current;
+      if (!canvas) return;
+      if (canvas.width !== image.width || canvas.height !== image.height) {
+        canvas.width = image.width;
+        canvas.height = image.height;
+      }
+      canvas.getContext('2d')?.drawImage(image, 0, 0);
+      frameSizeRef.current = frame.metadata
+        ? { width: frame.metadata.deviceWidth, height: frame.metadata.deviceHeight }
+        : { width: image.width, height: image.height };
+    };
+    image.src = `data:image/jpeg;base64,${frame.data}`;
+  };
+
+  const sendInput = (input: RemoteInput) => {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+      ws.send(JSON.stringify({ version: 1, type: 'input', input }));
+    }
+  };
+
+  // Maps a point on the canvas to CSS pixels of the remote page
+  const toPagePoint = (event: React.MouseEvent<HTMLCanvasElement>) => {
+    const canvas = event.currentTarget;
+    const rect = canvas.getBoundingClientRect();
+    const size = frameSizeRef.current || { width: canvas.width, height: canvas.height };
+    return {
+      x: ((event.clientX - rect.left) / rect.width) * size.width,
+      y: ((event.clientY - rect.top) / rect.height) * size.height,
+    };
+  };
+
+  const handleMouse = (type: string) => (event: React.MouseEvent<HTMLCanvasElement>) => {
+    if (type === 'mouseMoved') {
+      const now = Date.now();
+      if (now - lastMouseMoveRef.current < mouseMoveInterval) return;
+      lastMouseMoveRef.current = now;
+    } else {
+      event.preventDefault();
+      event.currentTarget.focus();
+    }
+    const point = toPagePoint(event);
+    sendInput({
+      type,
+      x: point.x,
+      y: point.y,
+      button: type === 'mouseMoved' ? 'none' : mouseButtons[event.button] || 'none',
+      click_count: type === 'mouseMoved' ? 0 : event.detail || 1,
+      modifiers: inputModifiers(event),
+    });
+  };
+
+  const handleWheel = (event: React.WheelEvent<HTMLCanvasElement>) => {
+    const point = toPagePoint(event);
+    sendInput({
+      type: 'mouseWheel',
+      x: point.x,
+      y: point.y,
+      delta_x: event.deltaX,
+      delta_y: event.deltaY,
+      modifiers: inputModifiers(event),
+    });
+  };
+
+  const handleKey = (type: string) => (event: React.KeyboardEvent<HTMLCanvasElement>) => {
+    // Keys go to the remote page only, not to this one
+    event.preventDefault();
+    sendInput({
+      type,
+      key: event.key,
+      code: event.code,
+      // Printable keys and Enter carry their text, so keyDown also types it
+      text: type !== 'keyDown' ? undefined : event.key === 'Enter' ? '\r' : event.key.length === 1 ? event.key : undefined,
+      key_code: event.keyCode,
+      modifiers: inputModifiers(event),
+    });
+  };
+
   const handleStopRecording = async () => {
     setLoading(true);
     try {
@@ -187,6 +325,11 @@ const Recording: React.FC = () => {
       touchstart: 'cyan',
       change: 'magenta',
       submit: 'red',
+      dblclick: 'geekblue',
+      contextmenu: 'volcano',
+      hover: 'gold',
+      drag: 'lime',
+      upload: 'gold',
     };
     return colors[type] || 'default';
   };
@@ -280,6 +423,16 @@ const Recording: React.FC = () => {
                 />
               </Form.Item>
 
+              <Form.Item
+                name="headless"
+                label="无头模式"
+                valuePropName="checked"
+                initialValue={false}
+                extra="浏览器在服务器上运行，画面显示在本页面中并在此直接操作，适用于本机无法打开浏览器窗口的情况"
+              >
+                <Switch />
+              </Form.Item>
+
               <Form.Item>
                 <Button 
                   type="primary" 
@@ -298,12 +451,38 @@ const Recording: React.FC = () => {
           <Card title="录制中...">
             <Alert
               message="录制已启动"
-              description="请在打开的浏览器窗口中执行您的操作。所有操作都会被自动记录。"
+              description={headless
+                ? '请在下方画面中点击、滚动和输入，操作会转发到服务器上的浏览器并被自动记录。'
+                : '请在打开的浏览器窗口中执行您的操作。所有操作都会被自动记录。'}
               type="info"
               showIcon
               style={{ marginBottom: 16 }}
             />
 
+            {headless && (
+              <div style={{ marginBottom: 16, textAlign: 'center' }}>
+                <canvas
+                  ref={canvasRef}
+                  tabIndex={0}
+                  onMouseDown={handleMouse('mousePressed')}
+                  onMouseUp={handleMouse('mouseReleased')}
+                  onMouseMove={handleMouse('mouseMoved')}
+                  onWheel={handleWheel}
+                  onKeyDown={handleKey('keyDown')}
+                  onKeyUp={handleKey('keyUp')}
+                  onContextMenu={(e) => e.preventDefault()}
+                  style={{
+                    maxWidth: '100%',
+                    maxHeight: '70vh',
+                    border: '1px solid #d9d9d9',
+                    background: '#fafafa',
+                    outline: 'none',
+                    cursor: 'default',
+                  }}
+                />
+              </div>
+            )}
+
             <div style={{ marginBottom: 16 }}>
               <Text strong>已录制步骤: {recordedSteps?.length || 0}</Text>
             </div>
@@ -137,6 +137,17 @@ const TestCases: React.FC = () => {
     }
   };
 
+  const handleQuarantine = async (testCase: TestCase) => {
+    try {
+      await api.setTestCaseQuarantined(testCase.id, !testCase.quarantined);
+      message.success(testCase.quarantined ? '已解除隔离' : '已隔离');
+      loadTestCases();
+    } catch (error) {
+      console.error('Failed to update quarantine:', error);
+      message.error('更新隔离状态失败');
+    }
+  };
+
   const handleViewDetails = (testCase: TestCase) => {
     setSelectedTestCase(testCase);
     setIsDetailDrawerVisible(true);
@@ -250,6 +261,19 @@ const TestCases: React.FC = () => {
         </Tag>
       ),
     },
+    {
+      title: '稳定性',
+      key: 'flakiness',
+      width: 120,
+      render: (_, record) => (
+        <>
+          {record.is_flaky && (
+            <Tag color="orange">不稳定 {Math.round(record.flakiness_score * 100)}%</Tag>
+          )}
+          {record.quarantined && <Tag color="purple">已隔离</Tag>}
+        </>
+      ),
+    },
     {
       title: '创建者',
       dataIndex: ['user', 'username'],
@@ -293,6 +317,11 @@ const TestCases: React.FC = () => {
           >
             编辑
           </Button>
+          {(record.is_flaky || record.quarantined) && (
+            <Button type="link" size="small" onClick={() => handleQuarantine(record)}>
+              {record.quarantined ? '解除隔离' : '隔离'}
+            </Button>
+          )}
           <Popconfirm
             title="确定删除这个测试用例吗？"
             onConfirm={() => handleDelete(record.id)}
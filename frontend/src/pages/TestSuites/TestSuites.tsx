@@ -129,8 +129,13 @@ const TestSuites: React.FC = () => {
       tags: testSuite.tags,
       priority: testSuite.priority,
       cron_expression: testSuite.cron_expression,
+      schedule_timezone: testSuite.schedule_timezone,
+      overlap_policy: testSuite.overlap_policy,
+      missed_run_policy: testSuite.missed_run_policy,
       is_parallel: testSuite.is_parallel,
       timeout_minutes: testSuite.timeout_minutes,
+      retry_max_attempts: testSuite.retry_max_attempts,
+      retry_on: testSuite.retry_on ? testSuite.retry_on.split(',') : [],
     });
 
     // Get test suite details to load test cases
@@ -192,6 +197,7 @@ const TestSuites: React.FC = () => {
     try {
       const formData = {
         ...values,
+        retry_on: (values.retry_on || []).join(','),
         test_case_ids: targetKeys.map(key => parseInt(key)),
       };
 
@@ -538,6 +544,31 @@ const TestSuites: React.FC = () => {
             </Col>
           </Row>
 
+          <Row gutter={16}>
+            <Col span={8}>
+              <Form.Item name="retry_max_attempts" label="最多执行次数" initialValue={1}>
+                <Select>
+                  <Option value={1}>1 (不重试)</Option>
+                  <Option value={2}>2</Option>
+                  <Option value={3}>3</Option>
+                  <Option value={5}>5</Option>
+                </Select>
+              </Form.Item>
+            </Col>
+            <Col span={16}>
+              <Form.Item name="retry_on" label="重试的错误类型">
+                <Select mode="multiple" placeholder="全部错误类型" allowClear>
+                  <Option value="timeout">超时</Option>
+                  <Option value="navigation">页面导航</Option>
+                  <Option value="element">元素定位</Option>
+                  <Option value="assertion">断言失败</Option>
+                  <Option value="browser">浏览器异常</Option>
+                  <Option value="other">其他</Option>
+                </Select>
+              </Form.Item>
+            </Col>
+          </Row>
+
           <Form.Item name="tags" label="标签">
             <Input placeholder="请输入标签，多个标签用逗号分隔" />
           </Form.Item>
@@ -546,6 +577,25 @@ const TestSuites: React.FC = () => {
             <Input placeholder="如：0 0 2 * * ? (每天凌晨2点执行，留空表示手动执行)" />
           </Form.Item>
 
+          <Form.Item name="schedule_timezone" label="时区">
+            <Input placeholder="如：Asia/Shanghai (留空表示服务器时区)" />
+          </Form.Item>
+
+          <Form.Item name="overlap_policy" label="上次未完成时">
+            <Select placeholder="跳过本次执行">
+              <Option value="skip">跳过本次执行</Option>
+              <Option value="queue_one">排队等待（最多一次）</Option>
+              <Option value="cancel_previous">取消上次执行</Option>
+            </Select>
+          </Form.Item>
+
+          <Form.Item name="missed_run_policy" label="停机期间错过的执行">
+            <Select placeholder="跳过">
+              <Option value="skip">跳过</Option>
+              <Option value="run_once">启动后补执行一次</Option>
+            </Select>
+          </Form.Item>
+
           <Divider>选择测试用例</Divider>
           <Transfer
             dataSource={transferData}
@@ -596,6 +646,11 @@ const TestSuites: React.FC = () => {
               <Descriptions.Item label="超时时间">
                 {selectedTestSuite.timeout_minutes} 分钟
               </Descriptions.Item>
+              <Descriptions.Item label="失败重试">
+                {selectedTestSuite.retry_max_attempts > 1
+                  ? `最多执行 ${selectedTestSuite.retry_max_attempts} 次 (${selectedTestSuite.retry_on || '全部错误'})`
+                  : '不重试'}
+              </Descriptions.Item>
               <Descriptions.Item label="定时表达式">
                 {selectedTestSuite.cron_expression || '手动执行'}
               </Descriptions.Item>
@@ -12,6 +12,7 @@ import type {
   TestCase,
   TestSuite,
   TestExecution,
+  SuiteRun,
   TestReport,
   PageData,
 } from '../types';
@@ -49,6 +50,10 @@ class ApiService {
     // Response interceptor
     this.instance.interceptors.response.use(
       (response: AxiosResponse<ApiResponse>) => {
+        // Exported files are not wrapped in the response envelope
+        if (response.config.responseType === 'blob') {
+          return response;
+        }
         const { data } = response;
         if (data.code !== 200) {
           message.error(data.message || 'Request failed');
@@ -195,6 +200,15 @@ class ApiService {
     return response.data.data!;
   }
 
+  async setTestCaseQuarantined(id: number, quarantined: boolean): Promise<void> {
+    await this.instance.post(`/test-cases/${id}/${quarantined ? 'quarantine' : 'unquarantine'}`);
+  }
+
+  async getFlakyTestCases(projectId: number): Promise<TestCase[]> {
+    const response = await this.instance.get<ApiResponse<TestCase[]>>(`/projects/${projectId}/flaky-test-cases`);
+    return response.data.data!;
+  }
+
   // Test Suite APIs
   async getTestSuites(params?: {
     page?: number;
@@ -234,6 +248,41 @@ class ApiService {
     return response.data.data!;
   }
 
+  // Suite Run APIs
+  async getSuiteRuns(params?: {
+    page?: number;
+    page_size?: number;
+    test_suite_id?: number;
+    project_id?: number;
+    status?: string;
+  }): Promise<PageData<SuiteRun>> {
+    const response = await this.instance.get<ApiResponse<PageData<SuiteRun>>>('/suite-runs', { params });
+    return response.data.data!;
+  }
+
+  async getSuiteRun(id: number): Promise<SuiteRun> {
+    const response = await this.instance.get<ApiResponse<SuiteRun>>(`/suite-runs/${id}`);
+    return response.data.data!;
+  }
+
+  async stopSuiteRun(id: number): Promise<{ stopped_count: number }> {
+    const response = await this.instance.post<ApiResponse<{ stopped_count: number }>>(`/suite-runs/${id}/stop`);
+    return response.data.data!;
+  }
+
+  async rerunFailedSuiteRun(id: number): Promise<SuiteRun> {
+    const response = await this.instance.post<ApiResponse<SuiteRun>>(`/suite-runs/${id}/rerun-failed`);
+    return response.data.data!;
+  }
+
+  async exportSuiteRun(id: number, format: 'html' | 'junit' | 'allure' = 'html'): Promise<Blob> {
+    const response = await this.instance.get(`/suite-runs/${id}/export`, {
+      params: { format },
+      responseType: 'blob',
+    });
+    return response.data;
+  }
+
   // Execution APIs
   async getExecutions(params?: {
     page?: number;
@@ -282,6 +331,14 @@ class ApiService {
     return response.data.data!;
   }
 
+  async exportReport(id: number, format: 'html' | 'junit' | 'allure' = 'html'): Promise<Blob> {
+    const response = await this.instance.get(`/reports/${id}/export`, {
+      params: { format },
+      responseType: 'blob',
+    });
+    return response.data;
+  }
+
   async deleteReport(id: number): Promise<void> {
     await this.instance.delete(`/reports/${id}`);
   }
@@ -295,8 +352,9 @@ class ApiService {
   async startRecording(data: {
     target_url: string;
     device_id: number;
-  }): Promise<{ session_id: string }> {
-    const response = await this.instance.post<ApiResponse<{ session_id: string }>>('/recording/start', data);
+    headless?: boolean;
+  }): Promise<{ session_id: string; headless: boolean }> {
+    const response = await this.instance.post<ApiResponse<{ session_id: string; headless: boolean }>>('/recording/start', data);
     return response.data.data!;
   }
 
@@ -69,6 +69,12 @@ export interface TestCase {
   expected_result: string;
   tags: string;
   priority: number;
+  retry_max_attempts: number;
+  retry_on: string;
+  flakiness_score: number;
+  is_flaky: boolean;
+  quarantined: boolean;
+  quarantined_at?: string;
   status: number;
   user_id: number;
   user: User;
@@ -88,8 +94,16 @@ export interface TestSuite {
   test_case_count: number;
   schedule: string;
   cron_expression: string;
+  schedule_paused: boolean;
+  schedule_timezone: string;
+  overlap_policy: 'skip' | 'queue_one' | 'cancel_previous';
+  run_state: 'idle' | 'running';
+  missed_run_policy: 'skip' | 'run_once';
+  last_fired_at?: string;
   is_parallel: boolean;
   timeout_minutes: number;
+  retry_max_attempts: number;
+  retry_on: string;
   tags: string;
   priority: number;
   status: number;
@@ -105,8 +119,18 @@ export interface TestExecution {
   test_case: TestCase;
   test_suite_id?: number;
   test_suite?: TestSuite;
+  suite_run_id?: number;
   execution_type: 'test_case' | 'test_suite';
-  status: 'pending' | 'running' | 'success' | 'failed' | 'cancelled';
+  status: 'pending' | 'running' | 'success' | 'failed' | 'cancelled' | 'interrupted';
+  priority: number;
+  queue_position: number;
+  attempt: number;
+  retry_of_id?: number;
+  retried: boolean;
+  error_class: string;
+  environment_id: number;
+  case_revision: string;
+  quarantined: boolean;
   start_time: string;
   end_time?: string;
   duration: number;
@@ -122,6 +146,34 @@ export interface TestExecution {
   updated_at: string;
 }
 
+export interface SuiteRun {
+  id: number;
+  test_suite_id: number;
+  test_suite: TestSuite;
+  project_id: number;
+  environment_id: number;
+  environment: Environment;
+  trigger: 'manual' | 'schedule' | 'api' | 'rerun';
+  status: 'running' | 'passed' | 'failed' | 'cancelled';
+  rerun_of_id?: number;
+  is_visual: boolean;
+  total_cases: number;
+  passed_cases: number;
+  failed_cases: number;
+  error_cases: number;
+  cancelled_cases: number;
+  passed_on_retry_cases: number;
+  quarantined_cases: number;
+  start_time: string;
+  end_time?: string;
+  duration: number;
+  user_id: number;
+  user: User;
+  executions?: TestExecution[];
+  created_at: string;
+  updated_at: string;
+}
+
 export interface TestReport {
   id: number;
   name: string;
@@ -129,11 +181,14 @@ export interface TestReport {
   project: Project;
   test_suite_id?: number;
   test_suite?: TestSuite;
+  suite_run_id?: number;
   executions: TestExecution[];
   total_cases: number;
   passed_cases: number;
   failed_cases: number;
   error_cases: number;
+  passed_on_retry_cases: number;
+  quarantined_cases: number;
   start_time: string;
   end_time: string;
   duration: number;